@@ -38,6 +38,8 @@ _: {
         NOTIFICATION_ENDPOINT = "https://discord.com/api/webhooks/1421594472923267084/207qADiqkjML0Vllr8SX9kF0hgN3piPRxx8pb4tcODcgn-W8VoIVNELfWo7-rTkPlj99";
         LOCATOR_URL = "http://rss_locator:3000";
         SERVICE_FQDN = "rss_poller:3000";
+        # The local stack has no API tokens; let the frontend change the config.
+        AUTH_DISABLED = "true";
       };
     };
 
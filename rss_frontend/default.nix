@@ -16,6 +16,8 @@ let
     # LOCATOR_URL is a runtime concern — blank it out at build time so any
     # .env file cannot bake a localhost URL into the build output.
     LOCATOR_URL = "";
+    # Same for POLLER_TOKEN, which must never end up in the build output.
+    POLLER_TOKEN = "";
     buildPhase = ''
       runHook preBuild
       npm run build
@@ -2,8 +2,21 @@ import { useState, useEffect, useRef } from 'preact/hooks';
 
 type Status = { ok: true } | { ok: false; error: string } | null;
 
+// Subscription mirrors the poller's per-feed config object. Fields other than
+// the URL are preserved as-is so saving from this page never drops them.
+type Subscription = {
+  id?: string;
+  url: string;
+  name?: string;
+  tags?: string[];
+  disabled?: boolean;
+  poll_interval?: string;
+  webhook_url?: string;
+};
+
 const ConfigPage = () => {
-  const [feeds, setFeeds] = useState<string[]>([]);
+  const [feeds, setFeeds] = useState<Subscription[]>([]);
+  const [etag, setEtag] = useState<string | null>(null);
   const [loading, setLoading] = useState(true);
   const [inputValue, setInputValue] = useState('');
   const [submitting, setSubmitting] = useState(false);
@@ -12,9 +25,13 @@ const ConfigPage = () => {
 
   useEffect(() => {
     fetch('/api/config')
-      .then(r => r.json())
-      .then((data: { rss_feeds?: string[] }) => {
-        if (data.rss_feeds?.length) setFeeds(data.rss_feeds);
+      .then(r => {
+        setEtag(r.headers.get('ETag'));
+        return r.json();
+      })
+      .then((data: { feeds?: Subscription[]; rss_feeds?: string[] }) => {
+        if (data.feeds?.length) setFeeds(data.feeds);
+        else if (data.rss_feeds?.length) setFeeds(data.rss_feeds.map(url => ({ url })));
       })
       .catch(() => {})
       .finally(() => setLoading(false));
@@ -29,7 +46,7 @@ const ConfigPage = () => {
   const addFeed = () => {
     const url = inputValue.trim();
     if (!url) return;
-    if (feeds.includes(url)) {
+    if (feeds.some(f => f.url === url)) {
       showStatus({ ok: false, error: 'That URL is already in the list.' });
       return;
     }
@@ -39,12 +56,12 @@ const ConfigPage = () => {
       showStatus({ ok: false, error: 'Please enter a valid URL.' });
       return;
     }
-    setFeeds(prev => [...prev, url]);
+    setFeeds(prev => [...prev, { url }]);
     setInputValue('');
   };
 
   const removeFeed = (url: string) => {
-    setFeeds(prev => prev.filter(f => f !== url));
+    setFeeds(prev => prev.filter(f => f.url !== url));
   };
 
   const handleKeyDown = (e: KeyboardEvent) => {
@@ -58,15 +75,18 @@ const ConfigPage = () => {
     }
     setSubmitting(true);
     try {
+      const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+      if (etag) headers['If-Match'] = etag;
       const res = await fetch('/api/config', {
         method: 'POST',
-        headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ rss_feeds: feeds }),
+        headers,
+        body: JSON.stringify({ feeds }),
       });
       const data = await res.json();
       if (!res.ok) {
         showStatus({ ok: false, error: data.error ?? `Error ${res.status}` });
       } else {
+        setEtag(res.headers.get('ETag'));
         showStatus({ ok: true });
       }
     } catch {
@@ -108,13 +128,13 @@ const ConfigPage = () => {
         </p>
       ) : (
         <ul className="space-y-2 mb-6">
-          {feeds.map(url => (
-            <li key={url} className="flex items-center justify-between rounded-md border px-3 py-2 text-sm">
-              <span className="truncate mr-4 text-foreground">{url}</span>
+          {feeds.map(feed => (
+            <li key={feed.url} className="flex items-center justify-between rounded-md border px-3 py-2 text-sm">
+              <span className="truncate mr-4 text-foreground">{feed.name ?? feed.url}</span>
               <button
-                onClick={() => removeFeed(url)}
+                onClick={() => removeFeed(feed.url)}
                 className="shrink-0 text-muted-foreground hover:text-destructive transition-colors"
-                aria-label={`Remove ${url}`}
+                aria-label={`Remove ${feed.url}`}
               >
                 Remove
               </button>
@@ -0,0 +1,12 @@
+const POLLER_TOKEN = process.env.POLLER_TOKEN;
+
+/**
+ * Adds the poller's API token to headers. rss-poller refuses requests without
+ * a token once USERS_FILE or API_TOKENS is set, and config changes without
+ * one unless AUTH_DISABLED is set; POLLER_TOKEN must belong to an admin for
+ * config changes to be accepted.
+ */
+export function pollerHeaders(headers: Record<string, string> = {}): Record<string, string> {
+  if (!POLLER_TOKEN) return headers;
+  return { ...headers, Authorization: `Bearer ${POLLER_TOKEN}` };
+}
@@ -1,5 +1,6 @@
 import type { APIRoute } from 'astro';
 import { lookupService, locatorEndpoint } from '@/lib/locator';
+import { pollerHeaders } from '@/lib/poller';
 
 export const GET: APIRoute = async () => {
   const fqdn = await lookupService('poller');
@@ -11,6 +12,7 @@ export const GET: APIRoute = async () => {
   }
   try {
     const res = await fetch(`${fqdn}/config/feeds`, {
+      headers: pollerHeaders(),
       signal: AbortSignal.timeout(5000),
     });
     if (!res.ok) {
@@ -19,9 +21,10 @@ export const GET: APIRoute = async () => {
       });
     }
     const data = await res.json();
-    return new Response(JSON.stringify(data), {
-      headers: { 'Content-Type': 'application/json' },
-    });
+    const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+    const etag = res.headers.get('ETag');
+    if (etag) headers['ETag'] = etag;
+    return new Response(JSON.stringify(data), { headers });
   } catch {
     return new Response(JSON.stringify({ rss_feeds: [] }), {
       headers: { 'Content-Type': 'application/json' },
@@ -56,20 +59,39 @@ export const POST: APIRoute = async ({ request }) => {
   }
 
   try {
+    const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+    const ifMatch = request.headers.get('If-Match');
+    if (ifMatch) headers['If-Match'] = ifMatch;
     const res = await fetch(`${fqdn}/config`, {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
+      headers: pollerHeaders(headers),
       body: JSON.stringify(body),
     });
+    if (res.status === 412) {
+      return new Response(JSON.stringify({ error: 'Feeds were changed by someone else. Reload the page and try again.' }), {
+        status: 412,
+        headers: { 'Content-Type': 'application/json' },
+      });
+    }
+    if (res.status === 400) {
+      const upstream = await res.json().catch(() => null);
+      const problems: { field: string; message: string }[] = upstream?.problems ?? [];
+      const detail = problems.map(p => `${p.field} ${p.message}`).join('; ');
+      return new Response(JSON.stringify({ error: detail ? `Poller rejected config: ${detail}` : 'Poller rejected config: 400', problems }), {
+        status: 400,
+        headers: { 'Content-Type': 'application/json' },
+      });
+    }
     if (!res.ok) {
       return new Response(JSON.stringify({ error: `Poller rejected config: ${res.status}` }), {
         status: res.status,
         headers: { 'Content-Type': 'application/json' },
       });
     }
-    return new Response(JSON.stringify({ ok: true }), {
-      headers: { 'Content-Type': 'application/json' },
-    });
+    const respHeaders: Record<string, string> = { 'Content-Type': 'application/json' };
+    const etag = res.headers.get('ETag');
+    if (etag) respHeaders['ETag'] = etag;
+    return new Response(JSON.stringify({ ok: true }), { headers: respHeaders });
   } catch {
     return new Response(JSON.stringify({ error: 'Failed to reach rss-poller' }), {
       status: 500,
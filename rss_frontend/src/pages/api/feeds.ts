@@ -1,5 +1,6 @@
 import type { APIRoute } from 'astro';
 import { lookupService, locatorEndpoint } from '@/lib/locator';
+import { pollerHeaders } from '@/lib/poller';
 
 export const GET: APIRoute = async () => {
   if (!locatorEndpoint()) {
@@ -19,7 +20,7 @@ export const GET: APIRoute = async () => {
 
   try {
     const res = await fetch(`${fqdn}/rss`, {
-      headers: { 'Accept': 'application/json' },
+      headers: pollerHeaders({ 'Accept': 'application/json' }),
     });
     if (!res.ok) {
       return new Response(JSON.stringify({ error: `Upstream error: ${res.status}` }), {
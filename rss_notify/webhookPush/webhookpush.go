@@ -30,8 +30,13 @@ type PushMessage interface {
 type DiscordNotification struct {
 	Content    []string `json:"feed_url"`
 	WebHookURL string   `json:"webhook_url"`
+	// Updated is set by the poller when the items changed after they were first notified
+	Updated bool `json:"updated,omitempty"`
 }
 
+// updatedPrefix is put in front of messages about items that changed
+const updatedPrefix = "Updated: "
+
 // DiscordMessage is the final message that will get sent to the destination
 type DiscordMessage struct {
 	Content string `json:"content"`
@@ -51,7 +56,7 @@ func (d *DiscordNotification) GetContent(ctx context.Context, content []byte) ([
 		log.ErrorFmt("Received payload: %s", string(content))
 		return nil, err
 	}
-	span.SetAttributes(attribute.Int("messages.count", len(d.Content)))
+	span.SetAttributes(attribute.Int("messages.count", len(d.Content)), attribute.Bool("notification.updated", d.Updated))
 	return d.Content, nil
 }
 
@@ -122,6 +127,9 @@ func (d *DiscordNotification) toDiscordMessage(ctx context.Context, message []st
 	dm := DiscordMessage{
 		Content: message[0],
 	}
+	if d.Updated {
+		dm.Content = updatedPrefix + dm.Content
+	}
 
 	log.InfoFmt("payload: %v", dm.Content) // TODO: add trace_id
 	b, err := json.Marshal(&dm)
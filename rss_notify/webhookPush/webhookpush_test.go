@@ -87,6 +87,29 @@ func TestSendNotificationError(t *testing.T) {
 	}
 }
 
+func TestUpdatedMessagePrefix(t *testing.T) {
+	var d DiscordNotification
+	if _, err := d.GetContent(context.Background(), []byte(`{"feed_url":["https://mockedurl.com/a"],"updated":true}`)); err != nil {
+		t.Fatal(err)
+	}
+	b, err := d.toDiscordMessage(context.Background(), d.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"content":"Updated: https://mockedurl.com/a"}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	d = DiscordNotification{}
+	b, err = d.toDiscordMessage(context.Background(), []string{"https://mockedurl.com/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"content":"https://mockedurl.com/a"}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
 func mockReceiverEndpoint(status int) *httptest.Server {
 	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(status)
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+	"github.com/mmcdole/gofeed/rss"
+	"go.uber.org/zap"
+)
+
+// Keys under which hintRSSTranslator keeps the RSS channel hints in Feed.Custom.
+const (
+	customTTL       = "rss.ttl"
+	customSkipHours = "rss.skipHours"
+	customSkipDays  = "rss.skipDays"
+)
+
+// hintRSSTranslator is the default RSS translator that also keeps the channel's
+// ttl, skipHours and skipDays, which the universal feed model drops.
+type hintRSSTranslator struct {
+	gofeed.DefaultRSSTranslator
+}
+
+func (t *hintRSSTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	f, err := t.DefaultRSSTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+	channel, ok := feed.(*rss.Feed)
+	if !ok {
+		return f, nil
+	}
+	custom := make(map[string]string)
+	if channel.TTL != "" {
+		custom[customTTL] = channel.TTL
+	}
+	if len(channel.SkipHours) > 0 {
+		custom[customSkipHours] = strings.Join(channel.SkipHours, ",")
+	}
+	if len(channel.SkipDays) > 0 {
+		custom[customSkipDays] = strings.Join(channel.SkipDays, ",")
+	}
+	if len(custom) > 0 {
+		f.Custom = custom
+	}
+	return f, nil
+}
+
+// newFeedParser returns a parser that keeps the hints used by adaptive polling.
+func newFeedParser() *gofeed.Parser {
+	p := gofeed.NewParser()
+	p.RSSTranslator = &hintRSSTranslator{}
+	return p
+}
+
+// feedHints is what a feed tells us about how often it changes.
+type feedHints struct {
+	// TTL is the RSS <ttl>: how long the feed may be cached.
+	TTL time.Duration
+	// UpdatePeriod is sy:updatePeriod divided by sy:updateFrequency.
+	UpdatePeriod time.Duration
+	// ItemGap is the median time between the most recent items.
+	ItemGap   time.Duration
+	SkipHours []int
+	SkipDays  []time.Weekday
+}
+
+// maxGapItems is how many of the newest items are used to estimate ItemGap.
+const maxGapItems = 10
+
+// hintsFromFeed extracts the polling hints from a parsed feed.
+func hintsFromFeed(f *gofeed.Feed) feedHints {
+	var h feedHints
+	if v, err := strconv.Atoi(strings.TrimSpace(f.Custom[customTTL])); err == nil && v > 0 {
+		h.TTL = time.Duration(v) * time.Minute
+	}
+	for _, v := range strings.Split(f.Custom[customSkipHours], ",") {
+		if hour, err := strconv.Atoi(strings.TrimSpace(v)); err == nil && hour >= 0 && hour <= 24 {
+			// Some feeds count hours 1-24.
+			h.SkipHours = append(h.SkipHours, hour%24)
+		}
+	}
+	for _, v := range strings.Split(f.Custom[customSkipDays], ",") {
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			if strings.EqualFold(strings.TrimSpace(v), d.String()) {
+				h.SkipDays = append(h.SkipDays, d)
+			}
+		}
+	}
+	if sy, ok := f.Extensions["sy"]; ok {
+		h.UpdatePeriod = syndicationPeriod(extensionValue(sy, "updatePeriod"), extensionValue(sy, "updateFrequency"))
+	}
+	h.ItemGap = medianItemGap(f.Items)
+	return h
+}
+
+func extensionValue(exts map[string][]ext.Extension, name string) string {
+	if v := exts[name]; len(v) > 0 {
+		return strings.TrimSpace(v[0].Value)
+	}
+	return ""
+}
+
+// syndicationPeriod converts the RSS syndication module's updatePeriod and
+// updateFrequency into the time between updates.
+func syndicationPeriod(period, frequency string) time.Duration {
+	var d time.Duration
+	switch strings.ToLower(period) {
+	case "hourly":
+		d = time.Hour
+	case "daily", "":
+		d = 24 * time.Hour
+	case "weekly":
+		d = 7 * 24 * time.Hour
+	case "monthly":
+		d = 30 * 24 * time.Hour
+	case "yearly":
+		d = 365 * 24 * time.Hour
+	default:
+		return 0
+	}
+	if n, err := strconv.Atoi(frequency); err == nil && n > 0 {
+		d /= time.Duration(n)
+	}
+	return d
+}
+
+// medianItemGap returns the median time between consecutive items among the
+// newest maxGapItems, or 0 when fewer than three items carry a date.
+func medianItemGap(items []*gofeed.Item) time.Duration {
+	var dates []time.Time
+	for _, it := range items {
+		switch {
+		case it.PublishedParsed != nil:
+			dates = append(dates, *it.PublishedParsed)
+		case it.UpdatedParsed != nil:
+			dates = append(dates, *it.UpdatedParsed)
+		}
+	}
+	if len(dates) < 3 {
+		return 0
+	}
+	slices.SortFunc(dates, func(a, b time.Time) int { return b.Compare(a) })
+	dates = dates[:min(len(dates), maxGapItems)]
+	gaps := make([]time.Duration, 0, len(dates)-1)
+	for i := 1; i < len(dates); i++ {
+		gaps = append(gaps, dates[i-1].Sub(dates[i]))
+	}
+	slices.Sort(gaps)
+	return gaps[len(gaps)/2]
+}
+
+// adaptiveInterval derives a poll interval from hints: twice per expected
+// item, but never more often than the feed's ttl or update period allow.
+// The result stays within [lo, hi].
+func adaptiveInterval(fallback time.Duration, h feedHints, lo, hi time.Duration) time.Duration {
+	d := fallback
+	if h.ItemGap > 0 {
+		d = h.ItemGap / 2
+	}
+	d = max(d, h.TTL, h.UpdatePeriod)
+	return min(max(d, lo), hi)
+}
+
+// skip moves t past the hours and days the feed asked not to be polled in.
+// Both are in GMT as the RSS spec defines them. t never moves beyond limit.
+func (h feedHints) skip(t, limit time.Time) time.Time {
+	if len(h.SkipHours) == 0 && len(h.SkipDays) == 0 {
+		return t
+	}
+	for t.Before(limit) {
+		u := t.UTC()
+		if !slices.Contains(h.SkipHours, u.Hour()) && !slices.Contains(h.SkipDays, u.Weekday()) {
+			return t
+		}
+		t = u.Truncate(time.Hour).Add(time.Hour)
+	}
+	return limit
+}
+
+// adaptivePolling reports whether POLL_ADAPTIVE is enabled. Feeds with an
+// explicit poll_interval always keep it.
+func adaptivePolling() bool {
+	v := os.Getenv("POLL_ADAPTIVE")
+	if v == "" {
+		return false
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		log.ErrorFmt("invalid POLL_ADAPTIVE %q, adaptive polling disabled", v)
+	}
+	return on
+}
+
+// adaptiveBounds returns the interval bounds for adaptive polling from
+// POLL_MIN_INTERVAL and POLL_MAX_INTERVAL.
+func adaptiveBounds() (lo, hi time.Duration) {
+	lo = envInterval("POLL_MIN_INTERVAL", minPollInterval)
+	hi = envInterval("POLL_MAX_INTERVAL", 24*time.Hour)
+	if hi < lo {
+		log.Error("POLL_MAX_INTERVAL is below POLL_MIN_INTERVAL, using the minimum",
+			zap.Duration("min", lo), zap.Duration("max", hi))
+		hi = lo
+	}
+	return lo, hi
+}
+
+// envInterval reads a poll interval from the environment, falling back to def
+// when it is unset or outside the poll_interval bounds.
+func envInterval(name string, def time.Duration) time.Duration {
+	if v := os.Getenv(name); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= minPollInterval && d <= maxPollInterval {
+			return d
+		}
+		log.Error("invalid poll interval, using the default", zap.String("name", name), zap.String("value", v))
+	}
+	return def
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const hintedFeedContent = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+  <channel>
+    <title>Hinted</title>
+    <ttl>120</ttl>
+    <sy:updatePeriod>daily</sy:updatePeriod>
+    <sy:updateFrequency>4</sy:updateFrequency>
+    <skipHours><hour>0</hour><hour>1</hour></skipHours>
+    <skipDays><day>Sunday</day></skipDays>
+    <item><link>https://h.example/3</link><pubDate>Thu, 01 Jan 2026 12:00:00 GMT</pubDate></item>
+    <item><link>https://h.example/2</link><pubDate>Thu, 01 Jan 2026 06:00:00 GMT</pubDate></item>
+    <item><link>https://h.example/1</link><pubDate>Thu, 01 Jan 2026 00:00:00 GMT</pubDate></item>
+  </channel>
+</rss>`
+
+func TestHintsFromFeed(t *testing.T) {
+	f, err := newFeedParser().Parse(strings.NewReader(hintedFeedContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hintsFromFeed(f)
+	if h.TTL != 2*time.Hour {
+		t.Errorf("TTL = %v, want 2h", h.TTL)
+	}
+	if h.UpdatePeriod != 6*time.Hour {
+		t.Errorf("UpdatePeriod = %v, want 6h", h.UpdatePeriod)
+	}
+	if h.ItemGap != 6*time.Hour {
+		t.Errorf("ItemGap = %v, want 6h", h.ItemGap)
+	}
+	if len(h.SkipHours) != 2 || len(h.SkipDays) != 1 || h.SkipDays[0] != time.Sunday {
+		t.Errorf("unexpected skip hints %v %v", h.SkipHours, h.SkipDays)
+	}
+}
+
+func TestAdaptiveInterval(t *testing.T) {
+	lo, hi := time.Minute, 12*time.Hour
+	cases := []struct {
+		name string
+		h    feedHints
+		want time.Duration
+	}{
+		{name: "NoHints", want: 5 * time.Minute},
+		{name: "ItemGap", h: feedHints{ItemGap: 2 * time.Hour}, want: time.Hour},
+		{name: "TTLWins", h: feedHints{ItemGap: 2 * time.Hour, TTL: 3 * time.Hour}, want: 3 * time.Hour},
+		{name: "ClampedToMax", h: feedHints{ItemGap: 30 * 24 * time.Hour}, want: hi},
+		{name: "ClampedToMin", h: feedHints{ItemGap: 10 * time.Second}, want: lo},
+	}
+	for _, tc := range cases {
+		if got := adaptiveInterval(5*time.Minute, tc.h, lo, hi); got != tc.want {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestHintsSkip(t *testing.T) {
+	h := feedHints{SkipHours: []int{0, 1}, SkipDays: []time.Weekday{time.Sunday}}
+	sat := time.Date(2026, 1, 3, 23, 30, 0, 0, time.UTC)
+	limit := sat.Add(72 * time.Hour)
+	// Sunday is skipped entirely, then Monday 00:00 and 01:00.
+	if got, want := h.skip(sat.Add(time.Hour), limit), time.Date(2026, 1, 5, 2, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("skip = %v, want %v", got, want)
+	}
+	if got := h.skip(sat, limit); !got.Equal(sat) {
+		t.Errorf("an allowed time must not move, got %v", got)
+	}
+	if got := h.skip(sat.Add(time.Hour), sat.Add(2*time.Hour)); !got.Equal(sat.Add(2 * time.Hour)) {
+		t.Errorf("skip must stop at the limit, got %v", got)
+	}
+}
+
+func TestAdaptiveSchedule(t *testing.T) {
+	resetSchedule(t)
+	t.Setenv("POLL_ADAPTIVE", "true")
+	t.Setenv("POLL_JITTER", "0")
+	t.Setenv("POLL_MAX_INTERVAL", "4h")
+	p := pollSettingsFromEnv()
+
+	f, err := newFeedParser().Parse(strings.NewReader(hintedFeedContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subs := []Subscription{
+		{ID: "hinted", URL: "https://h.example/rss"},
+		{ID: "fixed", URL: "https://f.example/rss", PollInterval: Duration(time.Minute)},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+	// Monday noon, well clear of the skipped hours and days.
+	start := time.Date(2026, 1, 5, 12, 0, 0, 0, time.UTC)
+	dueFeeds(start, subs, p)
+	scheduleNext(start, subs, []*gofeed.Feed{f, f}, p)
+
+	views := scheduleSnapshot("", p)
+	if len(views) != 2 {
+		t.Fatalf("expected 2 scheduled feeds, got %+v", views)
+	}
+	if !views[0].Adaptive || time.Duration(views[0].Interval) != 4*time.Hour || views[0].Hints == nil {
+		t.Errorf("expected the hinted feed to be capped at 4h, got %+v", views[0])
+	}
+	if views[1].Adaptive || time.Duration(views[1].Interval) != time.Minute {
+		t.Errorf("an explicit poll_interval must stay fixed, got %+v", views[1])
+	}
+
+	rec := httptest.NewRecorder()
+	FeedScheduleHandler(rec, httptest.NewRequest(http.MethodGet, "/feeds/schedule", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"interval":"4h0m0s"`) {
+		t.Errorf("unexpected response %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,488 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// archivedItem is an item the poller fetched, kept after it left its feed.
+type archivedItem struct {
+	FeedID      string     `json:"feed_id"`
+	Key         string     `json:"key"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Content     string     `json:"content,omitempty"`
+	Link        string     `json:"link,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	FirstSeen   time.Time  `json:"first_seen"`
+	Fingerprint string     `json:"fingerprint"`
+}
+
+// id identifies the item within the archive. The same item in two feeds is archived twice.
+func (a *archivedItem) id() string {
+	return a.FeedID + "\n" + a.Key
+}
+
+// date is when the item was published, last updated, or else first fetched.
+func (a *archivedItem) date() time.Time {
+	switch {
+	case a.Published != nil:
+		return *a.Published
+	case a.Updated != nil:
+		return *a.Updated
+	}
+	return a.FirstSeen
+}
+
+// itemArchive keeps every fetched item for the retention period along with a
+// full-text index over them. With a path, items are appended to a log of one
+// JSON object per line that is replayed on start, like the seen store.
+type itemArchive struct {
+	mu        sync.RWMutex
+	items     map[string]*archivedItem
+	index     *searchIndex
+	retention time.Duration
+	now       func() time.Time
+
+	path string
+	file *os.File
+	// logged is the number of items in the log, expired and superseded ones included.
+	logged int
+}
+
+// archive is the active item archive. It starts in memory; OpenArchive swaps in the on-disk one.
+var archive = newItemArchive(archiveRetention())
+
+// archiveCompactSlack is how many stale lines the log may hold beyond the live items.
+const archiveCompactSlack = 1000
+
+// archiveRetention is how long items are kept, counted from their date.
+// ARCHIVE_RETENTION accepts a Go duration; "0" keeps items forever.
+func archiveRetention() time.Duration {
+	if v := os.Getenv("ARCHIVE_RETENTION"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			return d
+		}
+		log.ErrorFmt("invalid ARCHIVE_RETENTION %q, using the default", v)
+	}
+	return 90 * 24 * time.Hour
+}
+
+// archivePath returns where the archive log lives. ARCHIVE_FILE overrides the
+// default; "memory" keeps the archive in memory only.
+func archivePath() string {
+	if p := os.Getenv("ARCHIVE_FILE"); p != "" {
+		return p
+	}
+	return "/var/lib/rss-poller/archive.log"
+}
+
+func newItemArchive(retention time.Duration) *itemArchive {
+	return &itemArchive{
+		items:     make(map[string]*archivedItem),
+		index:     newSearchIndex(),
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// openItemArchive opens (or creates) the archive log at path and loads the items in it.
+func openItemArchive(path string, retention time.Duration) (*itemArchive, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	a := newItemArchive(retention)
+	valid, err := a.load(f)
+	if err == nil {
+		// Drop a torn last line so new items start on a clean line.
+		err = f.Truncate(valid)
+	}
+	if err == nil {
+		_, err = f.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		// nolint:errcheck
+		f.Close()
+		return nil, err
+	}
+	a.path, a.file = path, f
+	a.pruneLocked()
+	return a, nil
+}
+
+// load replays the log in r and returns the length of its valid prefix.
+func (a *itemArchive) load(r io.Reader) (int64, error) {
+	var valid int64
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return valid, nil
+		}
+		if err != nil {
+			return valid, err
+		}
+		var it archivedItem
+		if jerr := json.Unmarshal(bytes.TrimSpace(line), &it); jerr != nil {
+			log.ErrorFmt("archive: ignoring the log from a corrupt entry onwards: %v", jerr)
+			return valid, nil
+		}
+		a.putLocked(&it)
+		valid += int64(len(line))
+		a.logged++
+	}
+}
+
+func (a *itemArchive) putLocked(it *archivedItem) {
+	id := it.id()
+	a.items[id] = it
+	a.index.add(id, it.Title, it.Description+" "+it.Content)
+}
+
+// store archives items that are new or changed since they were last stored.
+// It returns how many were written.
+func (a *itemArchive) store(items []*archivedItem) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var buf bytes.Buffer
+	stored := 0
+	for _, it := range items {
+		if old, ok := a.items[it.id()]; ok {
+			if old.Fingerprint == it.Fingerprint {
+				continue
+			}
+			it.FirstSeen = old.FirstSeen
+		}
+		a.putLocked(it)
+		stored++
+		if a.file == nil {
+			continue
+		}
+		line, err := json.Marshal(it)
+		if err != nil {
+			return stored, err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	a.pruneLocked()
+	if a.file == nil || buf.Len() == 0 {
+		return stored, nil
+	}
+	if _, err := a.file.Write(buf.Bytes()); err != nil {
+		return stored, err
+	}
+	if err := a.file.Sync(); err != nil {
+		return stored, err
+	}
+	a.logged += stored
+	if a.logged > 2*len(a.items)+archiveCompactSlack {
+		return stored, a.compactLocked()
+	}
+	return stored, nil
+}
+
+// pruneLocked drops the items that are past the retention period.
+func (a *itemArchive) pruneLocked() {
+	if a.retention <= 0 {
+		return
+	}
+	cutoff := a.now().Add(-a.retention)
+	for id, it := range a.items {
+		if it.date().Before(cutoff) {
+			delete(a.items, id)
+			a.index.remove(id)
+		}
+	}
+}
+
+// cutoff returns the date before which items are not archived at all.
+func (a *itemArchive) cutoff() time.Time {
+	if a.retention <= 0 {
+		return time.Time{}
+	}
+	return a.now().Add(-a.retention)
+}
+
+// compactLocked rewrites the log with the live items only.
+func (a *itemArchive) compactLocked() error {
+	var buf bytes.Buffer
+	for _, it := range a.items {
+		line, err := json.Marshal(it)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(a.path, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(a.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// nolint:errcheck
+	a.file.Close()
+	a.file = f
+	a.logged = len(a.items)
+	return nil
+}
+
+func (a *itemArchive) Len() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.items)
+}
+
+func (a *itemArchive) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// searchQuery is a parsed GET /rss/search request.
+type searchQuery struct {
+	Text string
+	// FeedIDs restricts the results to these feeds; nil allows every feed.
+	FeedIDs map[string]bool
+	Since   time.Time
+	Until   time.Time
+	Limit   int
+}
+
+// searchHit is an archived item matching a query.
+type searchHit struct {
+	FeedID      string     `json:"feed_id"`
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Content     string     `json:"content,omitempty"`
+	Link        string     `json:"link,omitempty"`
+	Published   *time.Time `json:"published,omitempty"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	Score       float64    `json:"score"`
+
+	date time.Time
+}
+
+// search returns the number of matching items and the best q.Limit of them,
+// by relevance and then newest first.
+func (a *itemArchive) search(q searchQuery) (int, []searchHit) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var hits []searchHit
+	for id, score := range a.index.search(q.Text) {
+		it := a.items[id]
+		if q.FeedIDs != nil && !q.FeedIDs[it.FeedID] {
+			continue
+		}
+		d := it.date()
+		if (!q.Since.IsZero() && d.Before(q.Since)) || (!q.Until.IsZero() && d.After(q.Until)) {
+			continue
+		}
+		hits = append(hits, searchHit{
+			FeedID:      it.FeedID,
+			Title:       it.Title,
+			Description: it.Description,
+			Content:     it.Content,
+			Link:        it.Link,
+			Published:   it.Published,
+			Updated:     it.Updated,
+			Score:       score,
+			date:        d,
+		})
+	}
+	slices.SortFunc(hits, func(x, y searchHit) int {
+		if x.Score != y.Score {
+			if x.Score > y.Score {
+				return -1
+			}
+			return 1
+		}
+		return y.date.Compare(x.date)
+	})
+	return len(hits), hits[:min(len(hits), q.Limit)]
+}
+
+// archiveFeeds stores the items of the feeds fetched for subs in the archive.
+// Items dated before the retention period are left out.
+func archiveFeeds(ctx context.Context, subs []Subscription, feeds []*gofeed.Feed) {
+	_, span := startSpan(ctx, "helper.archiveFeeds", trace.SpanKindInternal)
+	defer span.End()
+
+	now := time.Now()
+	cutoff := archive.cutoff()
+	var items []*archivedItem
+	for i, f := range feeds {
+		if f == nil || i >= len(subs) {
+			continue
+		}
+		for _, it := range f.Items {
+			k := itemKey(it)
+			if k == "" {
+				continue
+			}
+			if d := itemDate(it); !cutoff.IsZero() && d != nil && d.Before(cutoff) {
+				continue
+			}
+			items = append(items, &archivedItem{
+				FeedID:      subs[i].ID,
+				Key:         k,
+				Title:       it.Title,
+				Description: it.Description,
+				Content:     it.Content,
+				Link:        it.Link,
+				Published:   it.PublishedParsed,
+				Updated:     it.UpdatedParsed,
+				FirstSeen:   now,
+				Fingerprint: itemFingerprint(it),
+			})
+		}
+	}
+	stored, err := archive.store(items)
+	if err != nil {
+		spanErrorf(span, err, "failed to persist archived items: %v", err)
+	}
+	span.SetAttributes(attribute.Int("archive.stored", stored), attribute.Int("archive.size", archive.Len()))
+}
+
+// OpenArchive replaces the in-memory item archive with the on-disk one so
+// archived items survive a restart. If the log cannot be opened the poller
+// keeps archiving in memory.
+func OpenArchive(ctx context.Context) {
+	_, span := startSpan(ctx, "bootstrap.OpenArchive", trace.SpanKindInternal)
+	defer span.End()
+
+	path := archivePath()
+	span.SetAttributes(attribute.String("archive.path", path))
+	if path == "memory" {
+		log.Info("item archive kept in memory, it starts empty after a restart")
+		return
+	}
+	a, err := openItemArchive(path, archiveRetention())
+	if err != nil {
+		spanErrorf(span, err, "failed to open item archive %s, keeping it in memory: %v", path, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("archive.size", a.Len()))
+	log.Info("loaded archived items", zap.Int("archive.size", a.Len()), zap.String("archive.path", path))
+	// nolint:errcheck
+	archive.Close()
+	archive = a
+}
+
+// Bounds of the limit parameter of GET /rss/search.
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// RSSSearchHandler runs a full-text search over the archived items
+// (GET /rss/search?q=). Results can be narrowed with feed (a feed ID), tag,
+// and since/until (RFC 3339 dates), and are capped by limit.
+func RSSSearchHandler(w http.ResponseWriter, r *http.Request) {
+	_, span := startSpan(r.Context(), "handlers.RSSSearchHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /rss/search established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	q, err := parseSearchQuery(r)
+	if err != nil {
+		httpSpanError(span, r.Method, err.Error(), http.StatusBadRequest)
+		w.Header().Set("Content-Type", "application/json")
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	total, hits := archive.search(q)
+	if hits == nil {
+		hits = []searchHit{}
+	}
+
+	span.SetAttributes(attribute.Int("search.total", total), attribute.Int("search.returned", len(hits)))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, struct {
+		Query string      `json:"query"`
+		Total int         `json:"total"`
+		Items []searchHit `json:"items"`
+	}{Query: q.Text, Total: total, Items: hits})
+}
+
+func parseSearchQuery(r *http.Request) (searchQuery, error) {
+	v := r.URL.Query()
+	q := searchQuery{Text: v.Get("q"), Limit: defaultSearchLimit}
+	if len(tokenize(q.Text)) == 0 {
+		return q, errors.New("missing search terms in q")
+	}
+	if id := v.Get("feed"); id != "" {
+		q.FeedIDs = map[string]bool{id: true}
+	}
+	if tag := v.Get("tag"); tag != "" {
+		tagged := getConfigSnapshot().feedIDsWithTag(tag)
+		if q.FeedIDs != nil {
+			for id := range q.FeedIDs {
+				if !tagged[id] {
+					delete(q.FeedIDs, id)
+				}
+			}
+		} else {
+			q.FeedIDs = tagged
+		}
+	}
+	if usersEnabled() {
+		owned := ownedConfig(r.Context()).feedIDs()
+		if q.FeedIDs != nil {
+			for id := range q.FeedIDs {
+				if !owned[id] {
+					delete(q.FeedIDs, id)
+				}
+			}
+		} else {
+			q.FeedIDs = owned
+		}
+	}
+	var err error
+	if s := v.Get("since"); s != "" {
+		if q.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, errors.New("since must be an RFC 3339 date")
+		}
+	}
+	if s := v.Get("until"); s != "" {
+		if q.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			return q, errors.New("until must be an RFC 3339 date")
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxSearchLimit {
+			return q, errors.New("limit must be between 1 and " + strconv.Itoa(maxSearchLimit))
+		}
+		q.Limit = n
+	}
+	return q, nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestSearchIndexRanking(t *testing.T) {
+	idx := newSearchIndex()
+	idx.add("title", "Go 1.26 released", "The release notes.")
+	idx.add("body", "Weekly news", "A short mention of <b>Go</b> among other things, like Rust and Zig.")
+	idx.add("other", "Gardening", "Tomatoes &amp; peppers.")
+
+	scores := idx.search("go GO release")
+	if _, ok := scores["other"]; ok {
+		t.Error("expected documents without the terms not to match")
+	}
+	if scores["title"] <= scores["body"] {
+		t.Errorf("expected the title match to rank first, got %v", scores)
+	}
+	if s := idx.search("peppers"); s["other"] == 0 {
+		t.Error("expected HTML entities to be decoded before indexing")
+	}
+
+	idx.remove("title")
+	if s := idx.search("release"); len(s) != 0 {
+		t.Errorf("expected a removed document not to match, got %v", s)
+	}
+	idx.add("body", "Weekly news", "Nothing about it any more.")
+	if s := idx.search("rust"); len(s) != 0 {
+		t.Errorf("expected a re-added document to drop its old terms, got %v", s)
+	}
+}
+
+func TestItemArchiveRestartAndRetention(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "archive.log")
+	a, err := openItemArchive(path, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recent := time.Now().Add(-time.Hour)
+	old := time.Now().Add(-40 * 24 * time.Hour)
+	items := []*archivedItem{
+		{FeedID: "f", Key: "1", Title: "Kept", Published: &recent, Fingerprint: "a"},
+		{FeedID: "f", Key: "2", Title: "Expired", Published: &old, Fingerprint: "b"},
+	}
+	if n, err := a.store(items); err != nil || n != 2 {
+		t.Fatalf("store() = %d, %v", n, err)
+	}
+	if a.Len() != 1 {
+		t.Errorf("expected the expired item to be pruned, got %d items", a.Len())
+	}
+	// Unchanged items are not written again.
+	if n, _ := a.store([]*archivedItem{{FeedID: "f", Key: "1", Title: "Kept", Published: &recent, Fingerprint: "a"}}); n != 0 {
+		t.Errorf("expected an unchanged item not to be stored again, stored %d", n)
+	}
+	// nolint:errcheck
+	a.Close()
+
+	reopened, err := openItemArchive(path, 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	total, hits := reopened.search(searchQuery{Text: "kept expired", Limit: 10})
+	if total != 1 || hits[0].Title != "Kept" {
+		t.Errorf("expected only the kept item after a restart, got %v", hits)
+	}
+}
+
+func TestRSSSearchHandler(t *testing.T) {
+	subs := []Subscription{
+		{ID: "news", URL: "http://news.example/feed", Tags: []string{"News"}},
+		{ID: "blog", URL: "http://blog.example/feed"},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+	archive = newItemArchive(0)
+	t.Cleanup(func() { archive = newItemArchive(archiveRetention()) })
+
+	jan := time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)
+	mar := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	archiveFeeds(context.Background(), subs, []*gofeed.Feed{
+		{Items: []*gofeed.Item{
+			{GUID: "n1", Title: "Kernel release", Link: "http://news.example/1", PublishedParsed: &jan},
+			{GUID: "n2", Title: "Kernel patches", Description: "More kernel work", Link: "http://news.example/2", PublishedParsed: &mar},
+		}},
+		{Items: []*gofeed.Item{
+			{GUID: "b1", Title: "My kernel build", Link: "http://blog.example/1", PublishedParsed: &mar},
+		}},
+	})
+
+	search := func(query string) (int, []string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/rss/search?"+query, nil)
+		rr := httptest.NewRecorder()
+		RSSSearchHandler(rr, req)
+		if rr.Code != http.StatusOK {
+			return rr.Code, nil
+		}
+		var body struct {
+			Total int         `json:"total"`
+			Items []searchHit `json:"items"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		var links []string
+		for _, it := range body.Items {
+			links = append(links, it.Link)
+		}
+		if body.Total < len(links) {
+			t.Errorf("total %d is below the %d items returned", body.Total, len(links))
+		}
+		return rr.Code, links
+	}
+
+	if _, links := search("q=kernel+patches"); len(links) != 3 || links[0] != "http://news.example/2" {
+		t.Errorf("expected all three items, the one matching both terms first, got %v", links)
+	}
+	if _, links := search("q=kernel&tag=news&since=2026-02-01T00:00:00Z"); !reflect.DeepEqual(links, []string{"http://news.example/2"}) {
+		t.Errorf("unexpected results for tag and since filters: %v", links)
+	}
+	if _, links := search("q=kernel&feed=blog&until=2026-02-01T00:00:00Z"); len(links) != 0 {
+		t.Errorf("unexpected results for feed and until filters: %v", links)
+	}
+	if _, links := search("q=kernel&limit=1"); len(links) != 1 {
+		t.Errorf("expected limit to cap the results, got %v", links)
+	}
+	for _, bad := range []string{"q=", "q=kernel&since=yesterday", "q=kernel&limit=0"} {
+		if code, _ := search(bad); code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, code)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// baselineKeyPrefix marks, in the seen store, the feeds whose items were baselined.
+const baselineKeyPrefix = "feed-baseline:"
+
+// feedBaseline reports whether new feeds are baselined: the first successful
+// fetch of a feed marks its current items as seen instead of notifying them.
+// FEED_BASELINE accepts a boolean and defaults to true.
+func feedBaseline() bool {
+	v := os.Getenv("FEED_BASELINE")
+	if v == "" {
+		return true
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		log.ErrorFmt("invalid FEED_BASELINE %q, baselining new feeds", v)
+		return true
+	}
+	return on
+}
+
+// itemMaxAge returns how old an item may be and still be notified. ITEM_MAX_AGE
+// accepts a Go duration; unset or "0" notifies items of any age.
+func itemMaxAge() time.Duration {
+	if v := os.Getenv("ITEM_MAX_AGE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			return d
+		}
+		log.ErrorFmt("invalid ITEM_MAX_AGE %q, notifying items of any age", v)
+	}
+	return 0
+}
+
+// notifyCutoff returns the date before which items are not notified, or the
+// zero time when ITEM_MAX_AGE is not set.
+func notifyCutoff() time.Time {
+	if age := itemMaxAge(); age > 0 {
+		return time.Now().Add(-age)
+	}
+	return time.Time{}
+}
+
+// baselineFeeds marks the items of feeds fetched for the first time as seen
+// without notifying them, so adding a feed does not flood the receiver with
+// its history. It returns feeds with the baselined ones set to nil.
+//
+// Whether a feed was baselined is kept in the seen store next to its items,
+// so it survives restarts with the on-disk store. Every poll touches the
+// marker, which is only evicted once the feed stopped being polled.
+func baselineFeeds(ctx context.Context, subs []Subscription, feeds []*gofeed.Feed) []*gofeed.Feed {
+	if !feedBaseline() {
+		return feeds
+	}
+	_, span := startSpan(ctx, "helper.baselineFeeds", trace.SpanKindInternal)
+	defer span.End()
+
+	markers := make([]string, 0, len(feeds))
+	byMarker := make(map[string]int)
+	for i, f := range feeds {
+		if f == nil || i >= len(subs) {
+			continue
+		}
+		id := subs[i].ID
+		if id == "" {
+			id = feedID(subs[i].URL)
+		}
+		m := baselineKeyPrefix + id
+		markers = append(markers, m)
+		byMarker[m] = i
+	}
+	fresh, err := seen.Reserve(markers)
+	if err != nil {
+		span.RecordError(err)
+		return feeds
+	}
+	if len(fresh) == 0 {
+		return feeds
+	}
+
+	out := make([]*gofeed.Feed, len(feeds))
+	copy(out, feeds)
+	items := 0
+	for _, m := range fresh {
+		i := byMarker[m]
+		var keys []string
+		for _, it := range feeds[i].Items {
+			if k := seenKey(subs[i].Owner, it); k != "" {
+				keys = append(keys, k)
+			}
+		}
+		// Keys still pending for an earlier cycle's notification are left to it.
+		reserved, err := seen.Reserve(keys)
+		if err != nil {
+			span.RecordError(err)
+			seen.Release([]string{m})
+			continue
+		}
+		commitSeen(span, append(reserved, m), onlyKeys(itemFingerprints(subs[i].Owner, feeds[i:i+1]), reserved))
+		items += len(reserved)
+		out[i] = nil
+	}
+	span.SetAttributes(
+		attribute.Int("feeds.baselined", len(fresh)),
+		attribute.Int("items.baselined", items),
+	)
+	return out
+}
+
+// itemDate returns when an item was published, or last updated when it
+// carries no publication date.
+func itemDate(it *gofeed.Item) *time.Time {
+	if it.PublishedParsed != nil {
+		return it.PublishedParsed
+	}
+	return it.UpdatedParsed
+}
+
+// tooOld reports whether an item is dated before cutoff. Undated items never are.
+func tooOld(it *gofeed.Item, cutoff time.Time) bool {
+	d := itemDate(it)
+	return !cutoff.IsZero() && d != nil && d.Before(cutoff)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestBaselineFeeds(t *testing.T) {
+	seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+	t.Cleanup(func() { seen = newMemorySeenStore(seenMaxEntries(), seenTTL()) })
+
+	subs := []Subscription{{ID: "old", URL: "http://a.example/feed"}, {ID: "new", URL: "http://b.example/feed"}}
+	oldFeed := &gofeed.Feed{Items: []*gofeed.Item{{Link: "http://a.example/1"}}}
+	newFeed := &gofeed.Feed{Items: []*gofeed.Item{{Link: "http://b.example/1"}, {GUID: "b-2", Link: "http://b.example/2"}}}
+
+	// "old" was baselined in an earlier cycle.
+	got := baselineFeeds(context.Background(), subs[:1], []*gofeed.Feed{oldFeed})
+	if got[0] != nil {
+		t.Fatal("expected the first fetch of a feed to be baselined")
+	}
+
+	got = baselineFeeds(context.Background(), subs, []*gofeed.Feed{oldFeed, newFeed})
+	if got[0] != oldFeed || got[1] != nil {
+		t.Fatalf("expected only the new feed to be baselined, got %v", got)
+	}
+	for _, k := range []string{"http://b.example/1", "b-2"} {
+		if !seen.Has(k) {
+			t.Errorf("expected %q to be marked seen by the baseline", k)
+		}
+	}
+	if links, _ := collectNewLinks(context.Background(), "", []*gofeed.Feed{newFeed}); len(links) != 0 {
+		t.Errorf("expected baselined items not to be notified, got %v", links)
+	}
+
+	// A failed fetch neither baselines the feed nor hides it later.
+	seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+	baselineFeeds(context.Background(), subs[1:], []*gofeed.Feed{nil})
+	if got := baselineFeeds(context.Background(), subs[1:], []*gofeed.Feed{newFeed}); got[0] != nil {
+		t.Error("expected the first successful fetch to be baselined")
+	}
+}
+
+func TestBaselineFeedsDisabled(t *testing.T) {
+	t.Setenv("FEED_BASELINE", "false")
+	seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+	t.Cleanup(func() { seen = newMemorySeenStore(seenMaxEntries(), seenTTL()) })
+
+	f := &gofeed.Feed{Items: []*gofeed.Item{{Link: "http://a.example/1"}}}
+	got := baselineFeeds(context.Background(), []Subscription{{ID: "a"}}, []*gofeed.Feed{f})
+	if got[0] != f {
+		t.Error("expected no baseline with FEED_BASELINE=false")
+	}
+	if seen.Len() != 0 {
+		t.Errorf("expected nothing marked seen, got %d keys", seen.Len())
+	}
+}
+
+func TestCollectNewLinksMaxAge(t *testing.T) {
+	t.Setenv("ITEM_MAX_AGE", "72h")
+	seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+	t.Cleanup(func() { seen = newMemorySeenStore(seenMaxEntries(), seenTTL()) })
+
+	recent := time.Now().Add(-time.Hour)
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	feeds := []*gofeed.Feed{{Items: []*gofeed.Item{
+		{Link: "http://a.example/recent", PublishedParsed: &recent},
+		{Link: "http://a.example/republished", PublishedParsed: &old},
+		{Link: "http://a.example/updated", UpdatedParsed: &old},
+		{Link: "http://a.example/undated"},
+	}}}
+
+	links, keys := collectNewLinks(context.Background(), "", feeds)
+	want := []string{"http://a.example/recent", "http://a.example/undated"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("want %v, got %v", want, links)
+	}
+	if len(keys) != 4 {
+		t.Errorf("expected old items to be reserved too, got keys %v", keys)
+	}
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.uber.org/zap"
+)
+
+// Defaults of the CORS policy, enough for the frontend's dev server.
+const (
+	defaultCORSOrigins = "http://localhost:4321"
+	defaultCORSMethods = "GET, HEAD, POST, PUT, DELETE, OPTIONS"
+	defaultCORSHeaders = "Accept, Authorization, Content-Type, If-Match, Last-Event-ID"
+	// corsExposedHeaders are the response headers clients of the API read.
+	corsExposedHeaders = "ETag, Location, WWW-Authenticate, X-Total-Count, X-Next-Cursor"
+	// corsMaxAge is how long, in seconds, browsers may cache a preflight.
+	corsMaxAge = "600"
+)
+
+// corsPolicy is the cross-origin policy applied to every route.
+type corsPolicy struct {
+	// origins holds the allowed origins; "*" allows any origin.
+	origins     []string
+	methods     string
+	headers     string
+	credentials bool
+}
+
+// envList returns the comma separated values of the environment variable
+// name, or of def when it is unset.
+func envList(name, def string) []string {
+	v := os.Getenv(name)
+	if v == "" {
+		v = def
+	}
+	var out []string
+	for _, part := range strings.Split(v, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// corsPolicyFromEnv reads the policy from CORS_ALLOWED_ORIGINS,
+// CORS_ALLOWED_METHODS and CORS_ALLOWED_HEADERS, comma separated lists, and
+// CORS_ALLOW_CREDENTIALS. Credentials are refused along with the "*" origin,
+// since every site could then make credentialed requests.
+func corsPolicyFromEnv() corsPolicy {
+	p := corsPolicy{
+		origins: envList("CORS_ALLOWED_ORIGINS", defaultCORSOrigins),
+		methods: strings.Join(envList("CORS_ALLOWED_METHODS", defaultCORSMethods), ", "),
+		headers: strings.Join(envList("CORS_ALLOWED_HEADERS", defaultCORSHeaders), ", "),
+	}
+	if v := os.Getenv("CORS_ALLOW_CREDENTIALS"); v != "" {
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			log.Error("invalid CORS_ALLOW_CREDENTIALS, credentials not allowed", zap.String("value", v))
+		}
+		p.credentials = on
+	}
+	if p.credentials && slices.Contains(p.origins, "*") {
+		log.Error("CORS_ALLOW_CREDENTIALS cannot be combined with the * origin, credentials not allowed")
+		p.credentials = false
+	}
+	return p
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or ""
+// when origin may not call the API.
+func (p corsPolicy) allowOrigin(origin string) string {
+	switch {
+	case origin == "":
+		return ""
+	case slices.Contains(p.origins, origin):
+		return origin
+	case slices.Contains(p.origins, "*"):
+		return "*"
+	}
+	return ""
+}
+
+// CORS applies the CORS policy of the environment to next and answers
+// preflight requests for every route itself, before authentication, since
+// browsers send them without credentials.
+func CORS(next http.Handler) http.Handler {
+	p := corsPolicyFromEnv()
+	log.Info("CORS policy", zap.Strings("cors.origins", p.origins), zap.Bool("cors.credentials", p.credentials))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		allowed := p.allowOrigin(r.Header.Get("Origin"))
+		if allowed != "" {
+			h.Set("Access-Control-Allow-Origin", allowed)
+			if p.credentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if !preflight {
+				h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			}
+		}
+		if !preflight {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		if allowed != "" {
+			h.Set("Access-Control-Allow-Methods", p.methods)
+			h.Set("Access-Control-Allow-Headers", p.headers)
+			h.Set("Access-Control-Max-Age", corsMaxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
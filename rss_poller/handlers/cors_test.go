@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	call := func(h http.Handler, method, origin string, preflight bool) *httptest.ResponseRecorder {
+		t.Helper()
+		reached = false
+		req := httptest.NewRequest(method, "/config/feeds", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if preflight {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", "authorization, content-type")
+		}
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	h := CORS(next)
+	rr := call(h, http.MethodGet, "http://localhost:4321", false)
+	if !reached || rr.Header().Get("Access-Control-Allow-Origin") != "http://localhost:4321" || rr.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("expected the default origin to be allowed, got %v", rr.Header())
+	}
+	if rr := call(h, http.MethodGet, "https://evil.example", false); !reached || rr.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("expected an unknown origin to get no CORS headers, got %v", rr.Header())
+	}
+
+	// Preflights are answered before authentication and never reach the route.
+	rr = call(h, http.MethodOptions, "http://localhost:4321", true)
+	if reached || rr.Code != http.StatusNoContent {
+		t.Fatalf("expected the preflight to be answered with 204, got %d (reached %v)", rr.Code, reached)
+	}
+	if rr.Header().Get("Access-Control-Allow-Methods") != defaultCORSMethods || rr.Header().Get("Access-Control-Allow-Headers") != defaultCORSHeaders {
+		t.Errorf("unexpected preflight headers %v", rr.Header())
+	}
+	if rr := call(h, http.MethodOptions, "https://evil.example", true); reached || rr.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("expected a preflight from an unknown origin to be refused, got %v", rr.Header())
+	}
+	call(h, http.MethodOptions, "", false)
+	if !reached {
+		t.Error("expected a plain OPTIONS request to reach the route")
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://rss.example, *")
+	t.Setenv("CORS_ALLOWED_METHODS", "GET,POST")
+	t.Setenv("CORS_ALLOWED_HEADERS", "Authorization")
+	h = CORS(next)
+	if rr := call(h, http.MethodGet, "https://any.example", false); rr.Header().Get("Access-Control-Allow-Origin") != "*" || rr.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("expected a wildcard origin without credentials, got %v", rr.Header())
+	}
+	rr = call(h, http.MethodOptions, "https://rss.example", true)
+	if rr.Header().Get("Access-Control-Allow-Methods") != "GET, POST" || rr.Header().Get("Access-Control-Allow-Headers") != "Authorization" {
+		t.Errorf("expected the configured methods and headers, got %v", rr.Header())
+	}
+
+	t.Setenv("CORS_ALLOW_CREDENTIALS", "true")
+	h = CORS(next)
+	rr = call(h, http.MethodGet, "https://any.example", false)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "*" || rr.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("expected credentials to be refused with the * origin, got %v", rr.Header())
+	}
+	rr = call(h, http.MethodGet, "https://rss.example", false)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "https://rss.example" || rr.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("expected no credentials for listed origins either, got %v", rr.Header())
+	}
+
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://rss.example")
+	h = CORS(next)
+	rr = call(h, http.MethodGet, "https://rss.example", false)
+	if rr.Header().Get("Access-Control-Allow-Origin") != "https://rss.example" || rr.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("expected credentials for an explicitly allowed origin, got %v", rr.Header())
+	}
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	// errRevisionMismatch is returned when the caller's If-Match no longer matches the config revision.
+	errRevisionMismatch = errors.New("config was modified by someone else")
+	errFeedNotFound     = errors.New("feed not found")
+	errFeedConflict     = errors.New("feed already exists")
+)
+
+// configDiff lists the subscriptions that differ between two configs, matched by ID.
+type configDiff struct {
+	Added   []Subscription `json:"added"`
+	Removed []Subscription `json:"removed"`
+	Updated []Subscription `json:"updated"`
+}
+
+// configChangeResponse is returned by every endpoint that modifies the config.
+type configChangeResponse struct {
+	Revision uint64 `json:"revision"`
+	configDiff
+}
+
+func (d configDiff) empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Updated) == 0
+}
+
+// diffConfig compares two configs subscription by subscription.
+func diffConfig(prev, next ConfigStruct) configDiff {
+	d := configDiff{Added: []Subscription{}, Removed: []Subscription{}, Updated: []Subscription{}}
+	old := make(map[string]Subscription, len(prev.Feeds))
+	for _, s := range prev.Feeds {
+		old[s.ID] = s
+	}
+	for _, s := range next.Feeds {
+		o, ok := old[s.ID]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, s)
+		case !reflect.DeepEqual(o, s):
+			d.Updated = append(d.Updated, s)
+		}
+		delete(old, s.ID)
+	}
+	for _, s := range prev.Feeds {
+		if _, ok := old[s.ID]; ok {
+			d.Removed = append(d.Removed, s)
+		}
+	}
+	return d
+}
+
+// revisionETag formats a config revision as a strong ETag.
+func revisionETag(rev uint64) string {
+	return `"` + strconv.FormatUint(rev, 10) + `"`
+}
+
+// etagMatches implements the If-Match comparison for the config ETag.
+// If-Match uses strong comparison, so weak validators never match.
+func etagMatches(ifMatch string, rev uint64) bool {
+	want := revisionETag(rev)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// updateConfig applies mutate to a copy of the active config and swaps the copy
+// in only when mutate succeeds. A non-empty ifMatch must match the current
+// revision's ETag. The revision is bumped only when something changed, and every
+// new revision is added to the history together with the trace ID from ctx.
+// On error the returned config is the current one so callers can report its revision.
+func updateConfig(ctx context.Context, ifMatch string, mutate func(*ConfigStruct) error) (ConfigStruct, configDiff, error) {
+	cfgMu.Lock()
+	defer cfgMu.Unlock()
+
+	if ifMatch != "" && !etagMatches(ifMatch, cfg.Revision) {
+		return cfg.clone(), configDiff{}, errRevisionMismatch
+	}
+	next := cfg.clone()
+	if err := mutate(&next); err != nil {
+		return cfg.clone(), configDiff{}, err
+	}
+	next.normalize()
+	next.Revision = cfg.Revision
+
+	diff := diffConfig(cfg, next)
+	if diff.empty() {
+		return cfg.clone(), diff, nil
+	}
+	next.Revision++
+	cfg = next
+	recordRevision(ctx, next)
+	return next.clone(), diff, nil
+}
+
+// updateOwnedConfig is updateConfig for the subscriptions of owner: mutate sees
+// and changes only those, and whatever it leaves is stamped with owner. The
+// revision stays shared by all users. IDs derived from a URL are derived again
+// for owner; other IDs already taken by another user are a conflict.
+func updateOwnedConfig(ctx context.Context, owner, ifMatch string, mutate func(*ConfigStruct) error) (ConfigStruct, configDiff, error) {
+	next, diff, err := updateConfig(ctx, ifMatch, func(c *ConfigStruct) error {
+		view := c.ownedBy(owner)
+		if err := mutate(&view); err != nil {
+			return err
+		}
+		others := slices.DeleteFunc(c.Feeds, func(s Subscription) bool { return s.Owner == owner })
+		taken := ConfigStruct{Feeds: others}.feedIDs()
+		for i := range view.Feeds {
+			s := &view.Feeds[i]
+			if s.Owner != owner {
+				derived := s.ID == "" || s.ID == feedID(s.URL)
+				s.Owner = owner
+				if derived {
+					s.ID = s.defaultID()
+				}
+			}
+			if taken[s.ID] {
+				return fmt.Errorf("%w: id %s", errFeedConflict, s.ID)
+			}
+		}
+		c.Feeds = append(others, view.Feeds...)
+		return nil
+	})
+	return next.ownedBy(owner), diff, err
+}
+
+// commitConfigChange persists a config change and brings the poller in line with it.
+func commitConfigChange(ctx context.Context, diff configDiff) {
+	if diff.empty() {
+		return
+	}
+	persistConfig(ctx)
+	reconcilePolling()
+}
+
+// reconcilePolling starts the poller when there are feeds to poll and stops it
+// when none are left. A running poller reads the config on every tick, so
+// feed list changes never require a restart.
+func reconcilePolling() {
+	active := len(getConfigSnapshot().activeFeeds()) > 0
+	pollerMu.Lock()
+	running := cancelFn != nil
+	pollerMu.Unlock()
+
+	switch {
+	case active && !running:
+		startPolling()
+	case !active && running:
+		stopPolling()
+	}
+}
+
+// writeConfigError maps config update errors to HTTP status codes. Validation
+// failures list every problem so the client can fix them in one go.
+func writeConfigError(w http.ResponseWriter, span trace.Span, method string, err error, rev uint64) {
+	body := map[string]any{"error": err.Error(), "revision": rev}
+	status := http.StatusBadRequest
+	var verr *validationError
+	switch {
+	case errors.As(err, &verr):
+		body["error"] = "invalid config"
+		body["problems"] = verr.Problems
+	case errors.Is(err, errBodyTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, errRevisionMismatch):
+		status = http.StatusPreconditionFailed
+	case errors.Is(err, errFeedNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errFeedConflict):
+		status = http.StatusConflict
+	}
+	httpSpanError(span, method, err.Error(), status)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", revisionETag(rev))
+	writeJSON(w, status, body)
+}
+
+// decodeSubscription strictly reads and validates a single subscription from a JSON request body.
+func decodeSubscription(r *http.Request) (Subscription, error) {
+	var sub Subscription
+	if r.Header.Get("Content-Type") != "application/json" {
+		return sub, errors.New("the request does not contain a JSON payload")
+	}
+	// nolint:errcheck
+	defer r.Body.Close()
+	body, err := readLimited(r.Body, maxConfigBytes)
+	if err != nil {
+		return sub, err
+	}
+	if err := decodeStrict(body, &sub); err != nil {
+		return sub, &validationError{Problems: []fieldError{jsonFieldError("", err)}}
+	}
+	verr := &validationError{}
+	validateSubscription(&sub, "", verr)
+	return sub, verr.orNil()
+}
+
+// FeedCreateHandler adds a single subscription (POST /config/feeds).
+func FeedCreateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.FeedCreateHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to POST /config/feeds established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	sub, err := decodeSubscription(r)
+	if err != nil {
+		writeConfigError(w, span, r.Method, err, getConfigSnapshot().Revision)
+		return
+	}
+	sub.Owner = userFrom(ctx)
+	if sub.ID == "" {
+		sub.ID = sub.defaultID()
+	}
+
+	next, diff, err := updateOwnedConfig(ctx, sub.Owner, r.Header.Get("If-Match"), func(c *ConfigStruct) error {
+		if c.indexByURL(sub.URL) >= 0 {
+			return fmt.Errorf("%w: %s", errFeedConflict, sub.URL)
+		}
+		if c.indexByID(sub.ID) >= 0 {
+			return fmt.Errorf("%w: id %s", errFeedConflict, sub.ID)
+		}
+		c.Feeds = append(c.Feeds, sub)
+		return nil
+	})
+	if err != nil {
+		writeConfigError(w, span, r.Method, err, next.Revision)
+		return
+	}
+	commitConfigChange(ctx, diff)
+
+	span.SetAttributes(attribute.String("feed.id", sub.ID))
+	recordHTTPSpan(span, r.Method, http.StatusCreated)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", revisionETag(next.Revision))
+	w.Header().Set("Location", "/config/feeds/"+sub.ID)
+	writeJSON(w, http.StatusCreated, configChangeResponse{Revision: next.Revision, configDiff: diff})
+}
+
+// FeedHandler reads (GET), replaces (PUT) or deletes (DELETE) the subscription
+// named by the {id} path value.
+func FeedHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.FeedHandler", trace.SpanKindServer)
+	defer span.End()
+	id := r.PathValue("id")
+	span.SetAttributes(attribute.String("feed.id", id))
+	log.Info("connection to /config/feeds/{id} established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	var mutate func(*ConfigStruct) error
+	switch r.Method {
+	case http.MethodGet:
+		snapshot := ownedConfig(ctx)
+		i := snapshot.indexByID(id)
+		if i < 0 {
+			writeConfigError(w, span, r.Method, errFeedNotFound, snapshot.Revision)
+			return
+		}
+		recordHTTPSpan(span, r.Method, http.StatusOK)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", revisionETag(snapshot.Revision))
+		writeJSON(w, http.StatusOK, snapshot.Feeds[i])
+		return
+	case http.MethodPut:
+		sub, err := decodeSubscription(r)
+		if err != nil {
+			writeConfigError(w, span, r.Method, err, getConfigSnapshot().Revision)
+			return
+		}
+		if sub.ID != "" && sub.ID != id {
+			writeConfigError(w, span, r.Method, errors.New("feed id in body does not match the URL"), getConfigSnapshot().Revision)
+			return
+		}
+		sub.ID = id
+		sub.Owner = userFrom(ctx)
+		mutate = func(c *ConfigStruct) error {
+			i := c.indexByID(id)
+			if i < 0 {
+				return errFeedNotFound
+			}
+			if j := c.indexByURL(sub.URL); j >= 0 && j != i {
+				return fmt.Errorf("%w: %s", errFeedConflict, sub.URL)
+			}
+			c.Feeds[i] = sub
+			return nil
+		}
+	case http.MethodDelete:
+		mutate = func(c *ConfigStruct) error {
+			i := c.indexByID(id)
+			if i < 0 {
+				return errFeedNotFound
+			}
+			c.Feeds = slices.Delete(c.Feeds, i, i+1)
+			return nil
+		}
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	next, diff, err := updateOwnedConfig(ctx, userFrom(ctx), r.Header.Get("If-Match"), mutate)
+	if err != nil {
+		writeConfigError(w, span, r.Method, err, next.Revision)
+		return
+	}
+	commitConfigChange(ctx, diff)
+
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", revisionETag(next.Revision))
+	writeJSON(w, http.StatusOK, configChangeResponse{Revision: next.Revision, configDiff: diff})
+}
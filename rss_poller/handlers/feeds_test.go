@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// resetConfig replaces the active config for a test, clears the revision
+// history and restores an empty config afterwards.
+func resetConfig(t *testing.T, c ConfigStruct) {
+	t.Helper()
+	cfgMu.Lock()
+	cfg = c
+	cfgMu.Unlock()
+	historyMu.Lock()
+	history = nil
+	historyMu.Unlock()
+	t.Cleanup(func() {
+		stopPolling()
+		cfgMu.Lock()
+		cfg = ConfigStruct{}
+		cfgMu.Unlock()
+		historyMu.Lock()
+		history = nil
+		historyMu.Unlock()
+	})
+}
+
+func feedRequest(method, path, id, ifMatch string, body any) *http.Request {
+	var buf bytes.Buffer
+	if body != nil {
+		// nolint:errcheck
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	if id != "" {
+		req.SetPathValue("id", id)
+	}
+	return req
+}
+
+func decodeChange(t *testing.T, rec *httptest.ResponseRecorder) configChangeResponse {
+	t.Helper()
+	var resp configChangeResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return resp
+}
+
+func TestFeedCRUD(t *testing.T) {
+	resetConfig(t, ConfigStruct{Revision: 1, Feeds: []Subscription{{ID: "a", URL: "https://a.example/rss"}}})
+
+	t.Run("Create", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		FeedCreateHandler(rec, feedRequest(http.MethodPost, "/config/feeds", "", `"1"`, Subscription{ID: "b", URL: "https://b.example/rss", Name: "B"}))
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("ETag") != `"2"` || rec.Header().Get("Location") != "/config/feeds/b" {
+			t.Errorf("unexpected headers %v", rec.Header())
+		}
+		resp := decodeChange(t, rec)
+		if resp.Revision != 2 || len(resp.Added) != 1 || resp.Added[0].ID != "b" || len(resp.Removed) != 0 {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	})
+
+	t.Run("CreateDuplicateURL", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		FeedCreateHandler(rec, feedRequest(http.MethodPost, "/config/feeds", "", "", Subscription{URL: "https://a.example/rss"}))
+		if rec.Code != http.StatusConflict {
+			t.Errorf("expected 409, got %d", rec.Code)
+		}
+	})
+
+	t.Run("StaleRevision", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		FeedHandler(rec, feedRequest(http.MethodDelete, "/config/feeds/a", "a", `"1"`, nil))
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Fatalf("expected 412, got %d", rec.Code)
+		}
+		if getConfigSnapshot().indexByID("a") < 0 {
+			t.Error("stale delete must not modify the config")
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		FeedHandler(rec, feedRequest(http.MethodPut, "/config/feeds/b", "b", `"2"`, Subscription{URL: "https://b.example/rss", Name: "Renamed"}))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		resp := decodeChange(t, rec)
+		if resp.Revision != 3 || len(resp.Updated) != 1 || resp.Updated[0].Name != "Renamed" {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	})
+
+	t.Run("UpdateNoop", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		FeedHandler(rec, feedRequest(http.MethodPut, "/config/feeds/b", "b", "", Subscription{URL: "https://b.example/rss", Name: "Renamed"}))
+		if resp := decodeChange(t, rec); resp.Revision != 3 {
+			t.Errorf("a no-op update must not bump the revision, got %d", resp.Revision)
+		}
+	})
+
+	t.Run("Get", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		FeedHandler(rec, feedRequest(http.MethodGet, "/config/feeds/b", "b", "", nil))
+		var sub Subscription
+		if err := json.NewDecoder(rec.Body).Decode(&sub); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK || sub.Name != "Renamed" {
+			t.Errorf("unexpected response %d %+v", rec.Code, sub)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		FeedHandler(rec, feedRequest(http.MethodDelete, "/config/feeds/a", "a", `"3"`, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		resp := decodeChange(t, rec)
+		if len(resp.Removed) != 1 || resp.Removed[0].ID != "a" {
+			t.Errorf("unexpected response %+v", resp)
+		}
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		FeedHandler(rec, feedRequest(http.MethodDelete, "/config/feeds/a", "a", "", nil))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestReconcilePolling(t *testing.T) {
+	resetConfig(t, ConfigStruct{})
+
+	isRunning := func() bool {
+		pollerMu.Lock()
+		defer pollerMu.Unlock()
+		return cancelFn != nil
+	}
+
+	setRSSFeeds([]string{"https://a.example/rss"})
+	reconcilePolling()
+	if !isRunning() {
+		t.Fatal("expected poller to start once a feed is configured")
+	}
+
+	pollerMu.Lock()
+	first := ticker
+	pollerMu.Unlock()
+	setRSSFeeds([]string{"https://a.example/rss", "https://b.example/rss"})
+	reconcilePolling()
+	pollerMu.Lock()
+	same := ticker == first
+	pollerMu.Unlock()
+	if !same {
+		t.Error("a running poller must not be restarted for a feed list change")
+	}
+
+	setRSSFeeds(nil)
+	reconcilePolling()
+	if isRunning() {
+		t.Error("expected poller to stop once no feeds are left")
+	}
+}
+
+func TestEtagMatches(t *testing.T) {
+	cases := map[string]bool{
+		`"4"`:      true,
+		`W/"4"`:    false,
+		`"3", "4"`: true,
+		`*`:        true,
+		`"3"`:      false,
+		`4`:        false,
+	}
+	for header, want := range cases {
+		if got := etagMatches(header, 4); got != want {
+			t.Errorf("etagMatches(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
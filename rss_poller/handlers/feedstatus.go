@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// feedStatus is the outcome of the latest fetches of a feed.
+type feedStatus struct {
+	LastAttempt         time.Time  `json:"last_attempt"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	HTTPStatus          int        `json:"http_status,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	ItemCount           int        `json:"item_count"`
+	FetchDuration       Duration   `json:"fetch_duration"`
+}
+
+var (
+	// feedStatuses is keyed by feed URL, like the conditional cache.
+	feedStatuses   = make(map[string]*feedStatus)
+	feedStatusesMu sync.Mutex
+)
+
+// deferredFetch reports whether err skipped a fetch rather than failed it: the
+// host asked every feed on it to wait, or robots.txt keeps us out. Neither says
+// anything about the feed, so they do not count towards backoff or quarantine.
+func deferredFetch(err error) bool {
+	return errors.Is(err, errHostBackoff) || errors.Is(err, errRobotsDisallowed)
+}
+
+// recordFetch updates the status of feedURL after a fetch that started at start.
+// A feed that starts failing or recovers is logged once rather than on every poll.
+func recordFetch(feedURL string, start time.Time, feed *gofeed.Feed, hit bool, err error) {
+	feedStatusesMu.Lock()
+	defer feedStatusesMu.Unlock()
+	s, ok := feedStatuses[feedURL]
+	if !ok {
+		s = &feedStatus{}
+		feedStatuses[feedURL] = s
+	}
+	s.LastAttempt = start
+	s.FetchDuration = Duration(time.Since(start))
+
+	if deferredFetch(err) {
+		s.LastError = err.Error()
+		return
+	}
+	if err != nil {
+		s.ConsecutiveFailures++
+		s.LastError = err.Error()
+		s.HTTPStatus = 0
+		var httpErr gofeed.HTTPError
+		if errors.As(err, &httpErr) {
+			s.HTTPStatus = httpErr.StatusCode
+		}
+		if s.ConsecutiveFailures == 1 {
+			log.Error("feed started failing", zap.String("url", feedURL), zap.Error(err))
+		}
+		return
+	}
+
+	if s.ConsecutiveFailures > 0 {
+		log.Info("feed recovered", zap.String("url", feedURL), zap.Int("failures", s.ConsecutiveFailures))
+	}
+	s.ConsecutiveFailures = 0
+	s.LastError = ""
+	s.HTTPStatus = http.StatusOK
+	if hit {
+		s.HTTPStatus = http.StatusNotModified
+	}
+	s.LastSuccess = &start
+	s.ItemCount = len(feed.Items)
+}
+
+// lookupFeedStatus returns a copy of the status of feedURL.
+func lookupFeedStatus(feedURL string) (feedStatus, bool) {
+	feedStatusesMu.Lock()
+	defer feedStatusesMu.Unlock()
+	s, ok := feedStatuses[feedURL]
+	if !ok {
+		return feedStatus{}, false
+	}
+	return *s, true
+}
+
+// resetFeedFailures forgets the failures of feedURL, keeping the rest of its status.
+func resetFeedFailures(feedURL string) {
+	feedStatusesMu.Lock()
+	defer feedStatusesMu.Unlock()
+	if s, ok := feedStatuses[feedURL]; ok {
+		s.ConsecutiveFailures = 0
+	}
+}
+
+// pruneFeedStatuses forgets the status of feeds that are no longer configured.
+func pruneFeedStatuses(subs []Subscription) {
+	keep := make(map[string]bool, len(subs))
+	for _, s := range subs {
+		keep[s.URL] = true
+	}
+	feedStatusesMu.Lock()
+	defer feedStatusesMu.Unlock()
+	for u := range feedStatuses {
+		if !keep[u] {
+			delete(feedStatuses, u)
+		}
+	}
+}
+
+// Health states reported by GET /feeds/status.
+const (
+	feedStatePending     = "pending"
+	feedStateOK          = "ok"
+	feedStateFailing     = "failing"
+	feedStateDisabled    = "disabled"
+	feedStateQuarantined = "quarantined"
+)
+
+// feedStatusView is a subscription and the status of its fetches.
+type feedStatusView struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Name  string `json:"name,omitempty"`
+	State string `json:"state"`
+	// Status is missing until the feed was fetched once.
+	Status *feedStatus `json:"status,omitempty"`
+}
+
+// FeedStatusHandler reports the fetch health of every subscription (GET /feeds/status).
+func FeedStatusHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.FeedStatusHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /feeds/status established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	subs := ownedConfig(ctx).Feeds
+	views := make([]feedStatusView, 0, len(subs))
+	failing := 0
+	for _, s := range subs {
+		v := feedStatusView{ID: s.ID, URL: s.URL, Name: s.Name, State: feedStatePending}
+		st, ok := lookupFeedStatus(s.URL)
+		if ok {
+			v.Status = &st
+		}
+		switch {
+		case s.Disabled:
+			v.State = feedStateDisabled
+		case isQuarantined(s):
+			v.State = feedStateQuarantined
+		case ok && st.ConsecutiveFailures > 0:
+			v.State = feedStateFailing
+			failing++
+		case ok:
+			v.State = feedStateOK
+		}
+		views = append(views, v)
+	}
+
+	span.SetAttributes(attribute.Int("feeds.count", len(views)), attribute.Int("feeds.failing", failing))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, map[string][]feedStatusView{"feeds": views})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFeedStatusHandler(t *testing.T) {
+	good := startMockRSSFeedServer()
+	defer good.Close()
+	var failing atomic.Bool
+	failing.Store(true)
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		// nolint
+		w.Write([]byte(mockRSSFeedContent))
+	}))
+	defer flaky.Close()
+
+	subs := []Subscription{
+		{ID: "good", URL: good.URL, Name: "Good"},
+		{ID: "flaky", URL: flaky.URL},
+		{ID: "never", URL: "http://never.example/feed"},
+		{ID: "off", URL: "http://off.example/feed", Disabled: true},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+	t.Cleanup(func() { pruneFeedStatuses(nil) })
+
+	ctx := context.Background()
+	span := trace.SpanFromContext(ctx)
+	fetchFeeds(ctx, span, []string{good.URL, flaky.URL})
+	fetchFeeds(ctx, span, []string{flaky.URL})
+
+	status := func() map[string]feedStatusView {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		FeedStatusHandler(rr, httptest.NewRequest(http.MethodGet, "/feeds/status", nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rr.Code)
+		}
+		var body struct {
+			Feeds []feedStatusView `json:"feeds"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		views := make(map[string]feedStatusView)
+		for _, v := range body.Feeds {
+			views[v.ID] = v
+		}
+		return views
+	}
+
+	views := status()
+	if v := views["good"]; v.State != feedStateOK || v.Status.ItemCount != 2 || v.Status.LastSuccess == nil || v.Status.HTTPStatus != http.StatusOK {
+		t.Errorf("unexpected status for the good feed: %+v %+v", v, v.Status)
+	}
+	if v := views["flaky"]; v.State != feedStateFailing || v.Status.ConsecutiveFailures != 2 || v.Status.HTTPStatus != http.StatusInternalServerError || v.Status.LastError == "" || v.Status.LastSuccess != nil {
+		t.Errorf("unexpected status for the failing feed: %+v %+v", v, v.Status)
+	}
+	if views["never"].State != feedStatePending || views["never"].Status != nil {
+		t.Errorf("expected a feed that was never fetched to be pending, got %+v", views["never"])
+	}
+	if views["off"].State != feedStateDisabled {
+		t.Errorf("expected the disabled feed to be reported as such, got %+v", views["off"])
+	}
+
+	failing.Store(false)
+	fetchFeeds(ctx, span, []string{flaky.URL})
+	if v := status()["flaky"]; v.State != feedStateOK || v.Status.ConsecutiveFailures != 0 || v.Status.LastError != "" {
+		t.Errorf("expected the feed to recover, got %+v %+v", v, v.Status)
+	}
+}
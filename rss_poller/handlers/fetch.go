@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// conditionalEntry remembers the validators and parsed copy of a feed's last
+// full response, so the next fetch can be a conditional GET.
+type conditionalEntry struct {
+	etag         string
+	lastModified string
+	feed         *gofeed.Feed
+}
+
+var (
+	// conditionalCache is keyed by feed URL.
+	conditionalCache   = make(map[string]conditionalEntry)
+	conditionalCacheMu sync.Mutex
+)
+
+func lookupConditional(feedURL string) (conditionalEntry, bool) {
+	conditionalCacheMu.Lock()
+	defer conditionalCacheMu.Unlock()
+	e, ok := conditionalCache[feedURL]
+	return e, ok
+}
+
+func storeConditional(feedURL string, e conditionalEntry) {
+	conditionalCacheMu.Lock()
+	defer conditionalCacheMu.Unlock()
+	if e.etag == "" && e.lastModified == "" {
+		// Nothing to revalidate with next time.
+		delete(conditionalCache, feedURL)
+		return
+	}
+	conditionalCache[feedURL] = e
+}
+
+// pruneConditionalCache forgets the validators of feeds that are no longer configured.
+func pruneConditionalCache(subs []Subscription) {
+	keep := make(map[string]bool, len(subs))
+	for _, s := range subs {
+		keep[s.URL] = true
+	}
+	conditionalCacheMu.Lock()
+	defer conditionalCacheMu.Unlock()
+	for u := range conditionalCache {
+		if !keep[u] {
+			delete(conditionalCache, u)
+		}
+	}
+}
+
+// fetchFeed downloads and parses a single feed. When validators from an
+// earlier response are known it sends If-None-Match / If-Modified-Since, and a
+// 304 reuses the previously parsed feed and reports a cache hit. The outcome
+// is also recorded on span as feed.cache ("hit" or "miss").
+//
+// Requests are throttled per host by acquireHost, and a 429 or 503 makes the
+// whole host back off for its Retry-After. With ROBOTS_TXT enabled, feeds the
+// host's robots.txt disallows are not fetched.
+func fetchFeed(ctx context.Context, span trace.Span, feedURL string) (*gofeed.Feed, bool, error) {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil, false, err
+	}
+	if robotsEnabled() && !robotsAllowed(ctx, u) {
+		return nil, false, errRobotsDisallowed
+	}
+	release, err := acquireHost(ctx, u.Host)
+	if err != nil {
+		return nil, false, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, feedTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("User-Agent", feedUserAgent())
+	cached, haveCached := lookupConditional(feedURL)
+	if haveCached {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	// nolint:errcheck
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.status", resp.StatusCode))
+
+	if resp.StatusCode == http.StatusNotModified && haveCached {
+		span.SetAttributes(attribute.String("feed.cache", "hit"))
+		return cached.feed, true, nil
+	}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		d := backOffHost(u.Host, resp.Header.Get("Retry-After"))
+		span.SetAttributes(attribute.String("host.backoff", d.String()))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, false, gofeed.HTTPError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	span.SetAttributes(attribute.String("feed.cache", "miss"))
+
+	feed, err := newFeedParser().Parse(resp.Body)
+	if err != nil {
+		return nil, false, err
+	}
+	storeConditional(feedURL, conditionalEntry{
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+		feed:         feed,
+	})
+	return feed, false, nil
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestFetchFeedConditionalGET(t *testing.T) {
+	var full, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` && r.Header.Get("If-Modified-Since") == "Wed, 01 Jan 2025 00:00:00 GMT" {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Wed, 01 Jan 2025 00:00:00 GMT")
+		// nolint
+		w.Write([]byte(mockRSSFeedContent))
+	}))
+	defer server.Close()
+	t.Cleanup(func() { pruneConditionalCache(nil) })
+
+	span := trace.SpanFromContext(context.Background())
+	first, hit, err := fetchFeed(context.Background(), span, server.URL)
+	if err != nil || hit {
+		t.Fatalf("first fetch: hit=%v err=%v", hit, err)
+	}
+	second, hit, err := fetchFeed(context.Background(), span, server.URL)
+	if err != nil || !hit {
+		t.Fatalf("second fetch: hit=%v err=%v", hit, err)
+	}
+	if second != first {
+		t.Error("expected a 304 to reuse the previously parsed feed")
+	}
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("expected 1 full and 1 conditional response, got %d and %d", full.Load(), notModified.Load())
+	}
+
+	pruneConditionalCache(nil)
+	if _, hit, _ := fetchFeed(context.Background(), span, server.URL); hit || full.Load() != 2 {
+		t.Error("expected a pruned feed to be fetched in full")
+	}
+}
+
+func TestFetchFeedHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	if _, _, err := fetchFeed(context.Background(), trace.SpanFromContext(context.Background()), server.URL); err == nil {
+		t.Error("expected an error for a 404 response")
+	}
+}
@@ -6,10 +6,10 @@ import (
 	"encoding/json"
 	"errors"
 	"io"
+	"maps"
 	"net/http"
 	"os"
-	"strings"
-	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/FKouhai/rss-demo/libs/logger"
@@ -33,11 +33,7 @@ var sharedHTTPClient = &http.Client{
 		DisableCompression:  false,
 	}),
 }
-var (
-	seenMu               sync.Mutex
-	seen                 = make(map[string]bool)
-	notificationReceiver string
-)
+var notificationReceiver string
 
 func setNotificationReceiver(addr string) {
 	notifyMu.Lock()
@@ -45,12 +41,18 @@ func setNotificationReceiver(addr string) {
 	notifyMu.Unlock()
 }
 
+// errNotifyDisconnected is returned while there is no WebSocket to the notify
+// service, so the items of the notification are retried rather than lost.
+var errNotifyDisconnected = errors.New("WebSocket not connected to notify")
+
 // discordNotification is the payload sent to the notify service over WebSocket.
 type discordNotification struct {
 	Content     []string `json:"feed_url"`
 	WebHookURL  string   `json:"webhook_url"`
 	Traceparent string   `json:"traceparent,omitempty"`
 	Tracestate  string   `json:"tracestate,omitempty"`
+	// Updated marks notifications about items that changed after they were notified.
+	Updated bool `json:"updated,omitempty"`
 }
 
 func (d *discordNotification) sendNotification(ctx context.Context) error {
@@ -61,7 +63,7 @@ func (d *discordNotification) sendNotification(ctx context.Context) error {
 	spanCtx, span := startSpan(ctx, "helper.sendNotification", trace.SpanKindClient)
 	defer span.End()
 	span.AddEvent("SENDING_NOTIFICATION")
-	span.SetAttributes(attribute.Int("items.count", len(d.Content)))
+	span.SetAttributes(attribute.Int("items.count", len(d.Content)), attribute.Bool("notification.updated", d.Updated))
 
 	if d.Content == nil {
 		span.SetAttributes(attribute.Int("http.status", http.StatusNoContent))
@@ -89,8 +91,8 @@ func (d *discordNotification) sendNotification(ctx context.Context) error {
 	conn := wsConn
 	if conn == nil {
 		wsMu.Unlock()
-		log.Error("WebSocket not connected to notify, dropping notification")
-		return nil
+		span.RecordError(errNotifyDisconnected)
+		return errNotifyDisconnected
 	}
 	wsMu.Unlock()
 
@@ -116,19 +118,13 @@ func (d *discordNotification) sendNotification(ctx context.Context) error {
 }
 
 func processFeeds(ctx context.Context, feeds *gofeed.Feed) []feedsJSON {
-	var jFeed feedsJSON
 	var jFeeds []feedsJSON
 	_, span := startSpan(ctx, "helper.PROCESS_FEEDS", trace.SpanKindInternal)
 	defer span.End()
 	span.AddEvent("INTERNAL::processFeeds")
 	span.SetAttributes(attribute.Int("feed.items", len(feeds.Items)))
 	for _, v := range feeds.Items {
-		jFeed.Title = v.Title
-		jFeed.Content = v.Content
-		jFeed.Description = v.Description
-		jFeed.Link = v.Link
-		jFeed.Image = v.Image
-		jFeeds = append(jFeeds, jFeed)
+		jFeeds = append(jFeeds, newFeedsJSON(v))
 	}
 	return jFeeds
 }
@@ -140,7 +136,8 @@ func httpSpanError(span trace.Span, method string, logMsg string, httpCode int)
 }
 
 func toJSON(ctx context.Context, w io.Writer, feeds []*gofeed.Feed) error {
-	var jFeeds []feedsJSON
+	// An empty page is still a JSON array.
+	jFeeds := []feedsJSON{}
 	lctx, span := startSpan(ctx, "helper.toJSON", trace.SpanKindInternal)
 	defer span.End()
 	span.AddEvent("INTERNAL::toJSON")
@@ -160,6 +157,28 @@ func toJSON(ctx context.Context, w io.Writer, feeds []*gofeed.Feed) error {
 	return nil
 }
 
+// timelineToJSON writes a page of the /rss timeline, each item carrying its source feed.
+func timelineToJSON(ctx context.Context, w io.Writer, page []timelineItem) error {
+	_, span := startSpan(ctx, "helper.timelineToJSON", trace.SpanKindInternal)
+	defer span.End()
+	span.SetAttributes(attribute.Int("items.total", len(page)))
+
+	// An empty page is still a JSON array.
+	jFeeds := make([]feedsJSON, 0, len(page))
+	for _, it := range page {
+		jFeed := newFeedsJSON(it.item)
+		jFeed.Source = &it.source
+		flags := lookupItemFlags(it.feedID, it.key)
+		jFeed.Read, jFeed.Starred = flags.Read, flags.Starred
+		jFeeds = append(jFeeds, jFeed)
+	}
+	if err := json.NewEncoder(w).Encode(&jFeeds); err != nil {
+		httpSpanError(span, "GET", err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	return nil
+}
+
 func configFilePath() string {
 	if p := os.Getenv("CONFIG_FILE"); p != "" {
 		return p
@@ -167,35 +186,38 @@ func configFilePath() string {
 	return "/etc/rss-poller/config.json"
 }
 
-// LoadConfig reads feed URLs from the config file on startup.
-// If the file is absent it is a no-op; the service waits for POST /config.
+// LoadConfig reads feed subscriptions from the config file on startup.
+// Legacy files holding a bare "rss_feeds" list are migrated on the fly.
+// Users are read from USERS_FILE first. If the config file is absent nothing
+// else happens; the service waits for POST /config.
 // If feeds are present, polling starts immediately.
 func LoadConfig(ctx context.Context) {
-	_, span := startSpan(ctx, "bootstrap.LoadConfig", trace.SpanKindInternal)
+	ctx, span := startSpan(ctx, "bootstrap.LoadConfig", trace.SpanKindInternal)
 	defer span.End()
 
+	loadUsers()
 	path := configFilePath()
 	span.SetAttributes(attribute.String("config.path", path))
 
-	data, err := os.ReadFile(path)
+	loaded, err := readConfigFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			log.Info("no config file found, waiting for POST /config")
 			return
 		}
-		spanErrorf(span, err, "failed to read config file: %v", err)
+		spanErrorf(span, err, "failed to load config file: %v", err)
 		return
 	}
 
+	loaded = loadHistory(ctx, loaded)
+	loadQuarantine()
+	loadItemStates()
+
 	cfgMu.Lock()
-	if err := json.Unmarshal(data, &cfg); err != nil {
-		cfgMu.Unlock()
-		spanErrorf(span, err, "failed to parse config file: %v", err)
-		return
-	}
-	span.SetAttributes(attribute.Int("feeds.count", len(cfg.RSSFeeds)))
-	log.InfoFmt("loaded %d feeds from config file", len(cfg.RSSFeeds))
-	hasFeeds := len(cfg.RSSFeeds) > 0
+	cfg = loaded
+	span.SetAttributes(attribute.Int("feeds.count", len(cfg.Feeds)))
+	log.InfoFmt("loaded %d feeds from config file", len(cfg.Feeds))
+	hasFeeds := len(cfg.activeFeeds()) > 0
 	cfgMu.Unlock()
 
 	if hasFeeds {
@@ -206,11 +228,12 @@ func LoadConfig(ctx context.Context) {
 	}
 }
 
-// persistConfig writes the current cfg to the config file.
+// persistConfig atomically replaces the config file with the current cfg and
+// writes the revision history next to it.
 // It is best-effort: failure is logged but does not surface to the caller
 // since ConfigMap mounts in Kubernetes are read-only by design.
 func persistConfig(ctx context.Context) {
-	_, span := startSpan(ctx, "bootstrap.persistConfig", trace.SpanKindInternal)
+	ctx, span := startSpan(ctx, "bootstrap.persistConfig", trace.SpanKindInternal)
 	defer span.End()
 
 	path := configFilePath()
@@ -222,11 +245,14 @@ func persistConfig(ctx context.Context) {
 		return
 	}
 
-	if err := os.WriteFile(path, data, 0o644); err != nil {
+	if err := writeFileAtomic(path, data, 0o644); err != nil {
 		span.RecordError(err)
 		log.InfoFmt("config file not writable (expected in Kubernetes): %v", err)
 		return
 	}
+	// Our own write must not look like an external edit to WatchConfig.
+	setConfigFileHash(data)
+	persistHistory(ctx)
 
 	span.AddEvent("config persisted")
 	log.InfoFmt("persisted config to %s", path)
@@ -234,80 +260,116 @@ func persistConfig(ctx context.Context) {
 
 // ParseRSS returns the rss feed with all its items
 func ParseRSS(ctx context.Context, feedURL []string) ([]*gofeed.Feed, error) {
+	feeds, err := parseFeedsAligned(ctx, feedURL)
+	if err != nil {
+		return nil, err
+	}
+	return compactFeeds(feeds), nil
+}
+
+// parseFeedsAligned is ParseRSS without dropping failed feeds: the result is
+// index-aligned with feedURL and failed entries are nil. It only returns an
+// error when every feed failed.
+func parseFeedsAligned(ctx context.Context, feedURL []string) ([]*gofeed.Feed, error) {
 	_, span := startSpan(ctx, "helper.ParseRSS", trace.SpanKindClient)
 	defer span.End()
 	span.AddEvent("PARSING_FEED")
 	span.SetAttributes(attribute.Int("feeds.expected", len(feedURL)))
 
+	feeds := fetchFeeds(ctx, span, feedURL)
+	parsed := len(compactFeeds(feeds))
+	if parsed == 0 && len(feedURL) > 0 {
+		return nil, errors.New("all feeds failed to parse")
+	}
+
+	span.SetAttributes(attribute.Int("feeds.parsed", parsed))
+	span.AddEvent("got feed")
+	log.Info("got feed", zap.String("trace_id", span.SpanContext().TraceID().String()))
+	return feeds, nil
+}
+
+// compactFeeds drops the nil entries left by failed fetches.
+func compactFeeds(feeds []*gofeed.Feed) []*gofeed.Feed {
+	var out []*gofeed.Feed
+	for _, f := range feeds {
+		if f != nil {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// fetchFeeds downloads and parses every feed concurrently. The result is
+// index-aligned with feedURL; feeds that failed are left nil.
+func fetchFeeds(ctx context.Context, span trace.Span, feedURL []string) []*gofeed.Feed {
 	feeds := make([]*gofeed.Feed, len(feedURL))
+	var cacheHits atomic.Int64
 	eg, egCtx := errgroup.WithContext(ctx)
 	eg.SetLimit(10)
 
+	// Subscriptions of the same URL, from one user or several, share one fetch.
+	first := make(map[string]int, len(feedURL))
 	for i, v := range feedURL {
+		if _, ok := first[v]; ok {
+			continue
+		}
+		first[v] = i
 		eg.Go(func() error {
-			feedCtx, feedCancel := context.WithTimeout(egCtx, 8*time.Second)
-			defer feedCancel()
-			_, feedSpan := startSpan(feedCtx, "helper.ParseSingleFeed", trace.SpanKindInternal)
+			// fetchFeed applies the per-request timeout once the host lets the request through.
+			feedCtx, feedSpan := startSpan(egCtx, "helper.ParseSingleFeed", trace.SpanKindInternal)
 			feedSpan.SetAttributes(attribute.String("feed.url", v))
 			defer feedSpan.End()
-			feedParser := gofeed.NewParser()
-			feedParser.Client = sharedHTTPClient
-			feed, err := feedParser.ParseURLWithContext(v, feedCtx)
+			start := time.Now()
+			feed, hit, err := fetchFeed(feedCtx, feedSpan, v)
+			recordFetch(v, start, feed, hit, err)
 			if err != nil {
 				span.AddEvent("FAILED_PROCESS_FEED")
 				feedSpan.RecordError(err)
 				log.Debug("feed failed, skipping", zap.String("url", v), zap.Error(err))
 				return nil
 			}
+			if hit {
+				cacheHits.Add(1)
+			}
 			feeds[i] = feed
 			return nil
 		})
 	}
 
 	_ = eg.Wait() // individual feed errors are already handled per-goroutine above
-
-	var parsed []*gofeed.Feed
-	for _, f := range feeds {
-		if f != nil {
-			parsed = append(parsed, f)
-		}
-	}
-	if len(parsed) == 0 && len(feedURL) > 0 {
-		return nil, errors.New("all feeds failed to parse")
+	for i, v := range feedURL {
+		feeds[i] = feeds[first[v]]
 	}
-
-	span.SetAttributes(attribute.Int("feeds.parsed", len(parsed)))
-	span.AddEvent("got feed")
-	log.Info("got feed", zap.String("trace_id", span.SpanContext().TraceID().String()))
-	return parsed, nil
+	span.SetAttributes(attribute.Int64("feeds.cache_hits", cacheHits.Load()))
+	return feeds
 }
 
 // setRSSFeeds replaces the active feed list under the config lock.
+// Each URL becomes a subscription with default settings.
 func setRSSFeeds(feeds []string) {
 	cfgMu.Lock()
-	cfg.RSSFeeds = feeds
+	cfg.Feeds = subscriptionsFromURLs(feeds)
 	cfgMu.Unlock()
 }
 
-// handleConfigPayload validates the HTTP request and unmarshals the JSON payload.
-func handleConfigPayload(r *http.Request) error {
+// handleConfigPayload validates the HTTP request and strictly decodes the JSON payload.
+// The live config is left untouched; callers apply the result through updateConfig.
+func handleConfigPayload(r *http.Request) (ConfigStruct, error) {
 	if r.Method != http.MethodPost {
-		return errors.New("the wrong method was used")
+		return ConfigStruct{}, errors.New("the wrong method was used")
 	}
 	if r.Header.Get("Content-Type") != "application/json" {
-		return errors.New("the request does not contain a JSON payload")
+		return ConfigStruct{}, errors.New("the request does not contain a JSON payload")
 	}
-	body, err := io.ReadAll(r.Body)
 	// nolint:errcheck
 	defer r.Body.Close()
+	body, err := readLimited(r.Body, maxConfigBytes)
 	if err != nil {
-		return err
+		return ConfigStruct{}, err
 	}
-	log.Info(string(body))
+	log.Info("received config payload", zap.Int("payload.size", len(body)))
 
-	cfgMu.Lock()
-	defer cfgMu.Unlock()
-	return json.NewDecoder(strings.NewReader(string(body))).Decode(&cfg)
+	return decodeConfigPayload(body)
 }
 
 func itemKey(it *gofeed.Item) string {
@@ -317,67 +379,144 @@ func itemKey(it *gofeed.Item) string {
 	return it.Link
 }
 
-// collectNewLinks scans feeds and returns URLs not yet present in the seen map,
-// recording each newly encountered key into seen. Items with empty links are skipped.
+// seenKey is the seen-store key of it for the feeds of owner. Users keep
+// their own seen items, so a feed shared by several users notifies each.
+func seenKey(owner string, it *gofeed.Item) string {
+	k := itemKey(it)
+	if owner == "" || k == "" {
+		return k
+	}
+	return "user:" + owner + ":" + k
+}
+
+// collectNewLinks scans feeds and returns URLs whose items are not yet in the
+// seen store, reserving each newly encountered key. Items with empty links are skipped.
 // The GUID (or Link when no GUID) is used as the dedup key; only the Link is
 // appended to the returned slice so callers always receive real URLs.
+// Items dated before ITEM_MAX_AGE are reserved like the others but never sent,
+// so feeds that republish old posts do not notify them again.
+// The reserved keys are returned too: callers Commit them once the links were
+// delivered, or Release them so the next cycle tries again.
 // A child span is created so the dedup step is visible inside the PollAndNotify trace.
-func collectNewLinks(ctx context.Context, feeds []*gofeed.Feed) []string {
+func collectNewLinks(ctx context.Context, owner string, feeds []*gofeed.Feed) ([]string, []string) {
 	_, span := startSpan(ctx, "helper.collectNewLinks", trace.SpanKindInternal)
 	defer span.End()
 
-	var toSend []string
-	seenMu.Lock()
-	defer seenMu.Unlock()
+	cutoff := notifyCutoff()
+	var keys []string
+	links := make(map[string]string)
+	stale := 0
 	for _, feed := range feeds {
 		for _, it := range feed.Items {
-			k := itemKey(it)
-			if k == "" || seen[k] {
+			k := seenKey(owner, it)
+			if k == "" {
 				continue
 			}
-			seen[k] = true
-			if it.Link != "" {
-				toSend = append(toSend, it.Link)
+			keys = append(keys, k)
+			if _, ok := links[k]; ok {
+				continue
+			}
+			if tooOld(it, cutoff) {
+				links[k] = ""
+				stale++
+				continue
 			}
+			links[k] = it.Link
+		}
+	}
+	fresh, err := seen.Reserve(keys)
+	if err != nil {
+		span.RecordError(err)
+		return nil, nil
+	}
+	var toSend []string
+	for _, k := range fresh {
+		if link := links[k]; link != "" {
+			toSend = append(toSend, link)
 		}
 	}
-	span.SetAttributes(attribute.Int("new.items", len(toSend)))
-	return toSend
+	stats := seen.Stats()
+	span.SetAttributes(
+		attribute.Int("new.items", len(toSend)),
+		attribute.Int("stale.items", stale),
+		attribute.Int("seen.size", stats.Size),
+		attribute.Int("seen.pending", stats.Pending),
+		attribute.Int64("seen.evicted", int64(stats.Evicted)),
+	)
+	return toSend, fresh
 }
 
-// pollAndNotify contains the core logic for a single polling cycle.
-func pollAndNotify(t time.Time) {
-	log.InfoFmt("Poller ticker: tick at %v", t)
-
+// pollAndNotify fetches subs, notifies about new items and refreshes the
+// cached feeds served by /rss. It returns the feeds index-aligned with subs,
+// or nil when every fetch failed.
+func pollAndNotify(subs []Subscription) []*gofeed.Feed {
 	cycleCtx, cycleSpan := startSpan(context.Background(), "poller.PollAndNotify", trace.SpanKindInternal)
 	// Always end the cycle span when this function returns so the span
 	// lifecycle is deterministic and never leaks.
 	defer cycleSpan.End()
+	cycleSpan.SetAttributes(attribute.Int("feeds.due", len(subs)))
 
-	feeds, err := ParseRSS(cycleCtx, getConfigSnapshot().RSSFeeds)
+	urls := make([]string, len(subs))
+	for i, s := range subs {
+		urls[i] = s.URL
+	}
+	feeds, err := parseFeedsAligned(cycleCtx, urls)
 	if err != nil {
 		cycleSpan.RecordError(err)
-		return
+		return nil
 	}
 
-	// Deduplicate: collectNewLinks is a child span of PollAndNotify.
-	toSend := collectNewLinks(cycleCtx, feeds)
-	cycleSpan.SetAttributes(attribute.Int("new.items", len(toSend)))
-
-	// Safely update the globalFeed with the latest data.
-	feedMutex.Lock()
-	globalFeed = feeds
-	feedMutex.Unlock()
-
-	if len(toSend) == 0 {
-		return
-	}
 	notifyMu.RLock()
-	receiver := notificationReceiver
+	defaultReceiver := notificationReceiver
 	notifyMu.RUnlock()
-	if receiver == "" {
-		log.Error("NOTIFICATION_ENDPOINT not set, skipping notification.")
-		return
+
+	// Deduplicate per notification target: collectNewLinks is a child span of PollAndNotify.
+	// Feeds fetched for the first time are baselined and notify nothing.
+	known := baselineFeeds(cycleCtx, subs, feeds)
+	groups := groupByReceiver(subs, known, defaultReceiver)
+	var batches []notificationBatch
+	var freshKeys []string
+	updatedKeys := make(map[string]string)
+	newItems, updatedItems := 0, 0
+	for _, g := range groups {
+		links, keys := collectNewLinks(cycleCtx, g.owner, g.feeds)
+		fps := itemFingerprints(g.owner, g.feeds)
+		updLinks, updFPs := collectUpdatedLinks(cycleCtx, g.owner, g.feeds, fps, keys)
+		freshKeys = append(freshKeys, keys...)
+		maps.Copy(updatedKeys, updFPs)
+		newItems += len(links)
+		updatedItems += len(updLinks)
+		if len(links)+len(updLinks) > 0 && g.receiver == "" {
+			log.Error("NOTIFICATION_ENDPOINT not set, skipping notification.")
+		}
+		if len(links) == 0 || g.receiver == "" {
+			// Nothing will be delivered, so there is nothing to wait for.
+			commitSeen(cycleSpan, keys, onlyKeys(fps, keys))
+		} else {
+			batches = append(batches, notificationBatch{receiver: g.receiver, links: links, keys: keys, fingerprints: onlyKeys(fps, keys)})
+		}
+		if len(updLinks) == 0 {
+			continue
+		}
+		if g.receiver == "" {
+			commitSeen(cycleSpan, nil, updFPs)
+			releaseUpdates(updFPs)
+			continue
+		}
+		batches = append(batches, notificationBatch{receiver: g.receiver, links: updLinks, fingerprints: updFPs, updated: true})
+	}
+	cycleSpan.SetAttributes(attribute.Int("new.items", newItems), attribute.Int("updated.items", updatedItems))
+
+	// Safely update the globalFeed with the latest data.
+	storeFeeds(subs, feeds)
+	archiveFeeds(cycleCtx, subs, feeds)
+	pruneItemStates(cycleCtx, subs, feeds)
+	// Stream clients see items right away, whether or not their notification
+	// goes out; an item whose notification fails is streamed again on retry.
+	publishItems(subs, known, freshKeys, updatedKeys)
+
+	if len(batches) == 0 {
+		return feeds
 	}
 
 	// Send the notification asynchronously so it does not delay updating
@@ -386,19 +525,122 @@ func pollAndNotify(t time.Time) {
 	// even after pollAndNotify has returned and cycleSpan has been exported.
 	// OTel parent-child linkage is recorded at child-start time (span IDs are
 	// copied), so ending the parent first does not break the trace hierarchy.
+	// Items only count as seen once their notification went out; a failed send
+	// releases them so the next cycle tries again. The same goes for the new
+	// fingerprints of updated items, which stay reserved until then.
 	notifCtx := trace.ContextWithSpan(context.Background(), cycleSpan)
-	notify := discordNotification{
-		Content:    toSend,
-		WebHookURL: receiver,
+	for _, b := range batches {
+		notify := discordNotification{
+			Content:    b.links,
+			WebHookURL: b.receiver,
+			Updated:    b.updated,
+		}
+		go func() {
+			if b.updated {
+				defer releaseUpdates(b.fingerprints)
+			}
+			if err := notify.sendNotification(notifCtx); err != nil {
+				log.ErrorFmt("Failed to send notification: %v", err)
+				seen.Release(b.keys)
+				return
+			}
+			commitSeen(cycleSpan, b.keys, b.fingerprints)
+		}()
 	}
-	go func() {
-		if err := notify.sendNotification(notifCtx); err != nil {
-			log.ErrorFmt("Failed to send notification: %v", err)
+	return feeds
+}
+
+// cachedFeeds returns the cached copy of each feed in subs, index-aligned
+// with subs. Feeds that were not fetched yet are nil.
+func cachedFeeds(subs []Subscription) []*gofeed.Feed {
+	feedMutex.RLock()
+	defer feedMutex.RUnlock()
+	feeds := make([]*gofeed.Feed, len(subs))
+	for i, s := range subs {
+		feeds[i] = feedCache[s.ID]
+	}
+	return feeds
+}
+
+// storeFeeds caches the feeds fetched for subs and rebuilds globalFeed in config
+// order. A feed that failed to parse keeps its previous copy; feeds that are
+// no longer active are dropped.
+func storeFeeds(subs []Subscription, feeds []*gofeed.Feed) {
+	active := getConfigSnapshot().activeFeeds()
+
+	feedMutex.Lock()
+	defer feedMutex.Unlock()
+	for i, s := range subs {
+		if feeds[i] != nil {
+			feedCache[s.ID] = feeds[i]
 		}
-	}()
+	}
+	keep := make(map[string]bool, len(active))
+	latest := make([]*gofeed.Feed, 0, len(active))
+	for _, s := range active {
+		keep[s.ID] = true
+		if f := feedCache[s.ID]; f != nil {
+			latest = append(latest, f)
+		}
+	}
+	for id := range feedCache {
+		if !keep[id] {
+			delete(feedCache, id)
+		}
+	}
+	globalFeed = latest
+}
+
+// notificationBatch is one notification of a polling cycle and the seen keys
+// and fingerprints it commits once delivered.
+type notificationBatch struct {
+	receiver     string
+	links        []string
+	keys         []string
+	fingerprints map[string]string
+	// updated batches carry items that changed rather than new ones.
+	updated bool
 }
 
-// startPolling initializes and runs the background poller goroutine.
+// receiverGroup holds the feeds of one polling cycle that belong to the same
+// user and notify the same target.
+type receiverGroup struct {
+	owner    string
+	receiver string
+	feeds    []*gofeed.Feed
+}
+
+// groupByReceiver pairs each parsed feed with the subscription at the same index
+// and groups them by owner and notification target, keeping subscription order.
+// Failed (nil) feeds are skipped and subscriptions without a WebhookURL fall
+// back to their owner's webhook, then to defaultReceiver.
+func groupByReceiver(subs []Subscription, feeds []*gofeed.Feed, defaultReceiver string) []receiverGroup {
+	var groups []receiverGroup
+	index := make(map[[2]string]int)
+	for i, f := range feeds {
+		if f == nil {
+			continue
+		}
+		var owner string
+		receiver := defaultReceiver
+		if i < len(subs) {
+			owner = subs[i].Owner
+			receiver = subs[i].receiver(defaultReceiver)
+		}
+		key := [2]string{owner, receiver}
+		pos, ok := index[key]
+		if !ok {
+			pos = len(groups)
+			index[key] = pos
+			groups = append(groups, receiverGroup{owner: owner, receiver: receiver})
+		}
+		groups[pos].feeds = append(groups[pos].feeds, f)
+	}
+	return groups
+}
+
+// startPolling initializes and runs the background poller goroutine, which
+// fetches each feed when its schedule says it is due.
 // Cancels any previously running poller before starting a new one.
 func startPolling() {
 	pollerMu.Lock()
@@ -410,13 +652,15 @@ func startPolling() {
 		ticker.Stop()
 	}
 
-	ticker = time.NewTicker(30 * time.Second)
+	ticker = time.NewTicker(schedulerResolution)
 	localTicker := ticker
 	pollCtx, cancel := context.WithCancel(context.Background())
 	cancelFn = cancel
+	settings := pollSettingsFromEnv()
+	runningSettings = &settings
 
 	go func() {
-		log.Info("Started long poller")
+		log.Info("Started long poller", zap.Duration("poll.interval", settings.interval), zap.Bool("poll.adaptive", settings.adaptive))
 		for {
 			select {
 			case <-pollCtx.Done():
@@ -424,8 +668,22 @@ func startPolling() {
 				localTicker.Stop()
 				return
 			case t := <-localTicker.C:
-				pollAndNotify(t)
+				pollDue(t, settings)
 			}
 		}
 	}()
 }
+
+// stopPolling cancels the background poller, if any.
+func stopPolling() {
+	pollerMu.Lock()
+	defer pollerMu.Unlock()
+	if cancelFn != nil {
+		cancelFn()
+		cancelFn = nil
+	}
+	runningSettings = nil
+	if ticker != nil {
+		ticker.Stop()
+	}
+}
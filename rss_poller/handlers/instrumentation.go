@@ -36,11 +36,11 @@ func recordHTTPSpan(span trace.Span, method string, status int) {
 	)
 }
 
-// getConfigSnapshot returns a copy of the current config under the read lock.
+// getConfigSnapshot returns a deep copy of the current config under the read lock.
 func getConfigSnapshot() ConfigStruct {
 	cfgMu.RLock()
 	defer cfgMu.RUnlock()
-	return cfg
+	return cfg.clone()
 }
 
 // writeJSON writes status and JSON-encodes body to w, logging any encoding error.
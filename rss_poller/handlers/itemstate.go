@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// itemRef names an item of a subscription. Item is the item's GUID, or its
+// link when it has none, as in the guid and link fields of GET /rss.
+type itemRef struct {
+	Feed string `json:"feed"`
+	Item string `json:"item"`
+}
+
+// itemFlags is the reader state of an item. Items without flags are unread.
+type itemFlags struct {
+	Read    bool `json:"read,omitempty"`
+	Starred bool `json:"starred,omitempty"`
+}
+
+var (
+	// itemStates only holds items with at least one flag set.
+	itemStates   = make(map[itemRef]itemFlags)
+	itemStatesMu sync.Mutex
+)
+
+func itemStateFilePath() string {
+	return configFilePath() + ".items.json"
+}
+
+// lookupItemFlags returns the flags of the item with key in feed feedID.
+func lookupItemFlags(feedID, key string) itemFlags {
+	itemStatesMu.Lock()
+	defer itemStatesMu.Unlock()
+	return itemStates[itemRef{Feed: feedID, Item: key}]
+}
+
+// setItemFlagsLocked stores f for ref, dropping refs left without flags.
+// It reports whether anything changed.
+func setItemFlagsLocked(ref itemRef, f itemFlags) bool {
+	if itemStates[ref] == f {
+		return false
+	}
+	if f == (itemFlags{}) {
+		delete(itemStates, ref)
+	} else {
+		itemStates[ref] = f
+	}
+	return true
+}
+
+// unreadCounts counts the unread items of each feed in subs, as cached for GET /rss.
+func unreadCounts(subs []Subscription) map[string]int {
+	feeds := cachedFeeds(subs)
+	counts := make(map[string]int, len(subs))
+	itemStatesMu.Lock()
+	defer itemStatesMu.Unlock()
+	for i, s := range subs {
+		counts[s.ID] = 0
+		if feeds[i] == nil {
+			continue
+		}
+		for _, it := range feeds[i].Items {
+			if !itemStates[itemRef{Feed: s.ID, Item: itemKey(it)}].Read {
+				counts[s.ID]++
+			}
+		}
+	}
+	return counts
+}
+
+// pruneItemStates forgets the read flags of items that left their feed and the
+// state of feeds that are no longer configured. feeds is index-aligned with
+// subs; feeds that failed to fetch keep their state. Starred items are kept
+// until they are unstarred.
+func pruneItemStates(ctx context.Context, subs []Subscription, feeds []*gofeed.Feed) {
+	configured := make(map[string]bool)
+	for _, s := range getConfigSnapshot().Feeds {
+		configured[s.ID] = true
+	}
+	present := make(map[itemRef]bool)
+	fetched := make(map[string]bool)
+	for i, f := range feeds {
+		if f == nil || i >= len(subs) {
+			continue
+		}
+		fetched[subs[i].ID] = true
+		for _, it := range f.Items {
+			present[itemRef{Feed: subs[i].ID, Item: itemKey(it)}] = true
+		}
+	}
+
+	itemStatesMu.Lock()
+	pruned := 0
+	for ref, f := range itemStates {
+		switch {
+		case !configured[ref.Feed]:
+		case fetched[ref.Feed] && !present[ref] && !f.Starred:
+		default:
+			continue
+		}
+		delete(itemStates, ref)
+		pruned++
+	}
+	itemStatesMu.Unlock()
+	if pruned > 0 {
+		persistItemStates(ctx)
+	}
+}
+
+// loadItemStates restores the item states saved next to the config file.
+func loadItemStates() {
+	loaded := make(map[itemRef]itemFlags)
+	data, err := os.ReadFile(itemStateFilePath())
+	switch {
+	case err == nil:
+		var entries []itemStateEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			log.ErrorFmt("ignoring unreadable item state file: %v", err)
+		}
+		for _, e := range entries {
+			loaded[e.itemRef] = e.itemFlags
+		}
+	case !os.IsNotExist(err):
+		log.ErrorFmt("failed to read item state file: %v", err)
+	}
+	itemStatesMu.Lock()
+	itemStates = loaded
+	itemStatesMu.Unlock()
+}
+
+// itemStateEntry is how an item state is saved.
+type itemStateEntry struct {
+	itemRef
+	itemFlags
+}
+
+// persistItemStates writes the item states next to the config file.
+// Like persistConfig it is best-effort.
+func persistItemStates(ctx context.Context) {
+	_, span := startSpan(ctx, "bootstrap.persistItemStates", trace.SpanKindInternal)
+	defer span.End()
+
+	itemStatesMu.Lock()
+	entries := make([]itemStateEntry, 0, len(itemStates))
+	for ref, f := range itemStates {
+		entries = append(entries, itemStateEntry{ref, f})
+	}
+	itemStatesMu.Unlock()
+	data, err := json.Marshal(entries)
+	if err != nil {
+		span.RecordError(err)
+		return
+	}
+	path := itemStateFilePath()
+	span.SetAttributes(attribute.String("items.path", path), attribute.Int("items.count", len(entries)))
+	if err := writeFileAtomic(path, data, 0o644); err != nil {
+		span.RecordError(err)
+		log.InfoFmt("item state file not writable: %v", err)
+	}
+}
+
+// itemStateRequest is the body of POST /items/state. Read and Starred are
+// applied to every item; a missing field leaves that flag alone.
+type itemStateRequest struct {
+	Items   []itemRef `json:"items"`
+	Read    *bool     `json:"read"`
+	Starred *bool     `json:"starred"`
+}
+
+// markReadRequest is the body of POST /items/read.
+type markReadRequest struct {
+	Feed   string     `json:"feed"`
+	Before *time.Time `json:"before"`
+}
+
+// decodeItemRequest strictly reads a JSON request body into v.
+func decodeItemRequest(r *http.Request, v any) error {
+	if r.Header.Get("Content-Type") != "application/json" {
+		return errors.New("the request does not contain a JSON payload")
+	}
+	// nolint:errcheck
+	defer r.Body.Close()
+	body, err := readLimited(r.Body, maxConfigBytes)
+	if err != nil {
+		return err
+	}
+	return decodeStrict(body, v)
+}
+
+// writeItemError reports a failed item state request.
+func writeItemError(w http.ResponseWriter, span trace.Span, method string, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, errBodyTooLarge) {
+		status = http.StatusRequestEntityTooLarge
+	}
+	httpSpanError(span, method, err.Error(), status)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// ItemStateHandler marks single items read, unread, starred or unstarred
+// (POST /items/state).
+func ItemStateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.ItemStateHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to POST /items/state established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	var req itemStateRequest
+	if err := decodeItemRequest(r, &req); err != nil {
+		writeItemError(w, span, r.Method, err)
+		return
+	}
+	if len(req.Items) == 0 || (req.Read == nil && req.Starred == nil) {
+		writeItemError(w, span, r.Method, errors.New("items and at least one of read or starred are required"))
+		return
+	}
+	cfg := ownedConfig(ctx)
+	for _, ref := range req.Items {
+		if ref.Item == "" || cfg.indexByID(ref.Feed) < 0 {
+			writeItemError(w, span, r.Method, errors.New("unknown item "+ref.Feed+" "+ref.Item))
+			return
+		}
+	}
+
+	itemStatesMu.Lock()
+	changed := 0
+	for _, ref := range req.Items {
+		f := itemStates[ref]
+		if req.Read != nil {
+			f.Read = *req.Read
+		}
+		if req.Starred != nil {
+			f.Starred = *req.Starred
+		}
+		if setItemFlagsLocked(ref, f) {
+			changed++
+		}
+	}
+	itemStatesMu.Unlock()
+	if changed > 0 {
+		persistItemStates(ctx)
+	}
+
+	span.SetAttributes(attribute.Int("items.changed", changed))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, map[string]int{"changed": changed})
+}
+
+// MarkReadHandler marks the items of a feed, the items published before a
+// time, or both, as read (POST /items/read). It applies to the items
+// currently served by GET /rss.
+func MarkReadHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.MarkReadHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to POST /items/read established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	var req markReadRequest
+	if err := decodeItemRequest(r, &req); err != nil {
+		writeItemError(w, span, r.Method, err)
+		return
+	}
+	if req.Feed == "" && req.Before == nil {
+		writeItemError(w, span, r.Method, errors.New("feed or before is required"))
+		return
+	}
+	subs := ownedConfig(ctx).activeFeeds()
+	if req.Feed != "" {
+		i := ConfigStruct{Feeds: subs}.indexByID(req.Feed)
+		if i < 0 {
+			writeItemError(w, span, r.Method, errors.New("unknown feed "+req.Feed))
+			return
+		}
+		subs = subs[i : i+1]
+	}
+
+	feeds := cachedFeeds(subs)
+	itemStatesMu.Lock()
+	changed := 0
+	for i, f := range feeds {
+		if f == nil {
+			continue
+		}
+		for _, it := range f.Items {
+			// Undated items are only covered when a whole feed is marked.
+			if d := itemDate(it); req.Before != nil && (d == nil || !d.Before(*req.Before)) {
+				continue
+			}
+			ref := itemRef{Feed: subs[i].ID, Item: itemKey(it)}
+			flags := itemStates[ref]
+			flags.Read = true
+			if setItemFlagsLocked(ref, flags) {
+				changed++
+			}
+		}
+	}
+	itemStatesMu.Unlock()
+	if changed > 0 {
+		persistItemStates(ctx)
+	}
+
+	span.SetAttributes(attribute.Int("items.changed", changed))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, map[string]int{"changed": changed})
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestItemState(t *testing.T) {
+	subs := []Subscription{
+		{ID: "news", URL: "http://news.example/feed"},
+		{ID: "blog", URL: "http://blog.example/feed"},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+	day := func(d int) *time.Time {
+		t := time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC)
+		return &t
+	}
+	feedMutex.Lock()
+	feedCache = map[string]*gofeed.Feed{
+		"news": {Items: []*gofeed.Item{
+			{GUID: "n3", Link: "http://news.example/3", PublishedParsed: day(3)},
+			{GUID: "n1", Link: "http://news.example/1", PublishedParsed: day(1)},
+		}},
+		"blog": {Items: []*gofeed.Item{
+			{Link: "http://blog.example/2", PublishedParsed: day(2)},
+			{Link: "http://blog.example/undated"},
+		}},
+	}
+	feedMutex.Unlock()
+	t.Cleanup(func() {
+		feedMutex.Lock()
+		feedCache = make(map[string]*gofeed.Feed)
+		feedMutex.Unlock()
+		itemStatesMu.Lock()
+		itemStates = make(map[itemRef]itemFlags)
+		itemStatesMu.Unlock()
+		// nolint:errcheck
+		os.Remove(itemStateFilePath())
+	})
+
+	post := func(path, body string) int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		switch path {
+		case "/items/state":
+			ItemStateHandler(rr, req)
+		case "/items/read":
+			MarkReadHandler(rr, req)
+		}
+		return rr.Code
+	}
+	unread := func() map[string]int {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		ConfigGetHandler(rr, httptest.NewRequest(http.MethodGet, "/config/feeds", nil))
+		var body configResponse
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Unread
+	}
+	timeline := func(query string) []string {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		RSSHandler(rr, httptest.NewRequest(http.MethodGet, "/rss?"+query, nil))
+		var items []feedsJSON
+		if err := json.NewDecoder(rr.Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		links := []string{}
+		for _, it := range items {
+			links = append(links, it.Link)
+		}
+		return links
+	}
+
+	if got := unread(); !reflect.DeepEqual(got, map[string]int{"news": 2, "blog": 2}) {
+		t.Errorf("expected everything to start unread, got %v", got)
+	}
+
+	if code := post("/items/state", `{"items":[{"feed":"news","item":"n3"},{"feed":"blog","item":"http://blog.example/2"}],"read":true,"starred":true}`); code != http.StatusOK {
+		t.Fatalf("expected 200 marking items, got %d", code)
+	}
+	if code := post("/items/state", `{"items":[{"feed":"blog","item":"http://blog.example/2"}],"read":false}`); code != http.StatusOK {
+		t.Fatalf("expected 200 marking an item unread, got %d", code)
+	}
+	if got := unread(); !reflect.DeepEqual(got, map[string]int{"news": 1, "blog": 2}) {
+		t.Errorf("unexpected unread counts after marking single items: %v", got)
+	}
+	if got := timeline("starred=true"); !reflect.DeepEqual(got, []string{"http://news.example/3", "http://blog.example/2"}) {
+		t.Errorf("unexpected starred items %v", got)
+	}
+	if got := timeline("unread=true"); !reflect.DeepEqual(got, []string{"http://blog.example/2", "http://news.example/1", "http://blog.example/undated"}) {
+		t.Errorf("unexpected unread items %v", got)
+	}
+
+	if code := post("/items/read", `{"before":"2026-03-02T13:00:00Z"}`); code != http.StatusOK {
+		t.Fatalf("expected 200 marking items before a time, got %d", code)
+	}
+	if got := unread(); !reflect.DeepEqual(got, map[string]int{"news": 0, "blog": 1}) {
+		t.Errorf("expected only the undated item to stay unread, got %v", got)
+	}
+	if code := post("/items/read", `{"feed":"blog"}`); code != http.StatusOK {
+		t.Fatalf("expected 200 marking a feed, got %d", code)
+	}
+	if got := unread(); got["blog"] != 0 {
+		t.Errorf("expected the whole feed to be read, got %v", got)
+	}
+
+	// State survives a restart.
+	itemStatesMu.Lock()
+	itemStates = make(map[itemRef]itemFlags)
+	itemStatesMu.Unlock()
+	loadItemStates()
+	if f := lookupItemFlags("news", "n3"); !f.Read || !f.Starred {
+		t.Errorf("expected the item state to be restored from disk, got %+v", f)
+	}
+
+	// Items leaving their feed lose their read flag but stay starred.
+	pruneItemStates(context.Background(), subs, []*gofeed.Feed{{}, nil})
+	if f := lookupItemFlags("news", "n3"); !f.Starred {
+		t.Error("expected a starred item to be kept")
+	}
+	if f := lookupItemFlags("news", "n1"); f.Read {
+		t.Error("expected the read flag of a vanished item to be pruned")
+	}
+	if f := lookupItemFlags("blog", "http://blog.example/undated"); !f.Read {
+		t.Error("expected the state of a feed that failed to fetch to be kept")
+	}
+
+	for _, bad := range []struct{ path, body string }{
+		{"/items/state", `{"items":[{"feed":"news","item":"n3"}]}`},
+		{"/items/state", `{"items":[{"feed":"gone","item":"x"}],"read":true}`},
+		{"/items/read", `{}`},
+		{"/items/read", `{"feed":"gone"}`},
+		{"/items/read", `{"before":"yesterday"}`},
+	} {
+		if code := post(bad.path, bad.body); code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected 400, got %d", bad.path, bad.body, code)
+		}
+	}
+}
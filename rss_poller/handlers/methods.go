@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -21,21 +22,68 @@ import (
 
 // ConfigStruct contains the accepted config fields that this microservice will use
 type ConfigStruct struct {
-	RSSFeeds []string `json:"rss_feeds"`
+	// Revision is bumped on every change and doubles as the config ETag.
+	Revision uint64         `json:"revision"`
+	Feeds    []Subscription `json:"feeds"`
 }
 
+// configResponse is the body returned by GET /config/feeds. RSSFeeds mirrors the
+// active feed URLs for clients that still speak the legacy format.
+type configResponse struct {
+	Revision uint64         `json:"revision"`
+	Feeds    []Subscription `json:"feeds"`
+	RSSFeeds []string       `json:"rss_feeds"`
+	// Unread counts the unread items of each feed by feed ID.
+	Unread map[string]int `json:"unread"`
+}
+
+// feedsJSON is an item of the GET /rss response. Title, Description, Content,
+// Link and Image are what the frontend was built on and keep their meaning;
+// every field is omitted when the feed does not provide it.
 type feedsJSON struct {
 	Title       string        `json:"title,omitempty"`
 	Description string        `json:"description,omitempty"`
 	Content     string        `json:"content,omitempty"`
 	Link        string        `json:"link,omitempty"`
 	Image       *gofeed.Image `json:"image,omitempty"`
+	// GUID is the identifier the item has in its feed.
+	GUID string `json:"guid,omitempty"`
+	// Published and Updated are the item's own dates, in RFC 3339.
+	Published  *time.Time          `json:"published,omitempty"`
+	Updated    *time.Time          `json:"updated,omitempty"`
+	Authors    []*gofeed.Person    `json:"authors,omitempty"`
+	Categories []string            `json:"categories,omitempty"`
+	Enclosures []*gofeed.Enclosure `json:"enclosures,omitempty"`
+	// Source is the subscription the item was fetched from.
+	Source *feedSource `json:"source,omitempty"`
+	// Read and Starred are the reader state set through /items.
+	Read    bool `json:"read,omitempty"`
+	Starred bool `json:"starred,omitempty"`
+}
+
+// newFeedsJSON converts a parsed item to its /rss representation.
+func newFeedsJSON(it *gofeed.Item) feedsJSON {
+	return feedsJSON{
+		Title:       it.Title,
+		Description: it.Description,
+		Content:     it.Content,
+		Link:        it.Link,
+		Image:       it.Image,
+		GUID:        it.GUID,
+		Published:   it.PublishedParsed,
+		Updated:     it.UpdatedParsed,
+		Authors:     it.Authors,
+		Categories:  it.Categories,
+		Enclosures:  it.Enclosures,
+	}
 }
 
 var (
 	globalFeed []*gofeed.Feed
-	cfg        ConfigStruct
-	feedMutex  sync.RWMutex
+	// feedCache holds the latest parsed copy of each feed, keyed by feed ID.
+	feedCache = make(map[string]*gofeed.Feed)
+	cfg       ConfigStruct
+	feedMutex sync.RWMutex
 	// Store ticker and cancel func for cleanup
 	// nolint:unused // This variable is assigned in helpers.go and used for cleanup
 	ticker *time.Ticker
@@ -119,41 +167,56 @@ func ReadyHandler(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "ready"})
 }
 
-// ConfigHandler reads the config sent via json and stores it in memory.
-// It also starts a new background poller with the new configuration.
+// ConfigHandler reads the config sent via json and replaces the whole
+// subscription list with it. An If-Match header holding the config ETag makes
+// the replacement conditional. The response lists the feeds that changed.
 func ConfigHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	_, span := startSpan(ctx, "handlers.ConfigHandler", trace.SpanKindServer)
+	ctx, span := startSpan(r.Context(), "handlers.ConfigHandler", trace.SpanKindServer)
 	defer span.End()
 	log.Info("accepted connection", zap.String("trace_id", span.SpanContext().TraceID().String()))
 
-	if err := handleConfigPayload(r); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		httpSpanError(span, r.Method, err.Error(), http.StatusBadRequest)
+	payload, err := handleConfigPayload(r)
+	if err != nil {
+		writeConfigError(w, span, r.Method, err, getConfigSnapshot().Revision)
 		return
 	}
 
-	persistConfig(ctx)
-	startPolling()
+	next, diff, err := updateOwnedConfig(ctx, userFrom(ctx), r.Header.Get("If-Match"), func(c *ConfigStruct) error {
+		c.Feeds = payload.Feeds
+		return nil
+	})
+	if err != nil {
+		writeConfigError(w, span, r.Method, err, next.Revision)
+		return
+	}
+	commitConfigChange(ctx, diff)
 
 	recordHTTPSpan(span, r.Method, http.StatusOK)
-	span.SetAttributes(attribute.Int("feeds.count", len(getConfigSnapshot().RSSFeeds)))
-	w.WriteHeader(http.StatusOK)
+	span.SetAttributes(attribute.Int("feeds.count", len(next.Feeds)))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", revisionETag(next.Revision))
+	writeJSON(w, http.StatusOK, configChangeResponse{Revision: next.Revision, configDiff: diff})
 }
 
-// ConfigGetHandler returns the feed URLs currently being polled.
-// The frontend uses this to stay in sync with the active config.
+// ConfigGetHandler returns the configured subscriptions along with the feed URLs
+// currently being polled. The frontend uses this to stay in sync with the active config.
 func ConfigGetHandler(w http.ResponseWriter, r *http.Request) {
-	_, span := startSpan(r.Context(), "handlers.ConfigGetHandler", trace.SpanKindServer)
+	ctx, span := startSpan(r.Context(), "handlers.ConfigGetHandler", trace.SpanKindServer)
 	defer span.End()
 	log.Info("connection to GET /config/feeds established", zap.String("trace_id", span.SpanContext().TraceID().String()))
 
-	snapshot := getConfigSnapshot()
+	snapshot := ownedConfig(ctx)
 	recordHTTPSpan(span, r.Method, http.StatusOK)
-	span.SetAttributes(attribute.Int("feeds.count", len(snapshot.RSSFeeds)))
+	span.SetAttributes(attribute.Int("feeds.count", len(snapshot.Feeds)))
 
 	w.Header().Set("Content-Type", "application/json")
-	writeJSON(w, http.StatusOK, snapshot)
+	w.Header().Set("ETag", revisionETag(snapshot.Revision))
+	writeJSON(w, http.StatusOK, configResponse{
+		Revision: snapshot.Revision,
+		Feeds:    snapshot.Feeds,
+		RSSFeeds: snapshot.feedURLs(),
+		Unread:   unreadCounts(snapshot.Feeds),
+	})
 }
 
 // HealthzHandler is the route that exposes a healthcheck
@@ -164,27 +227,52 @@ func HealthzHandler(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "healthy"})
 }
 
-// RSSHandler is the route that exposes the rss feeds that have been polled
+// RSSHandler is the route that exposes the rss feeds that have been polled.
+// Items of all feeds are merged into one timeline, newest first. The feed
+// (repeatable), tag, since (RFC 3339), unread, starred, limit and cursor
+// parameters select a page; the total number of matching items and the cursor of the next page
+// are returned in the X-Total-Count and X-Next-Cursor headers. Without a limit
+// the JSON format returns every item and the syndication formats the newest
+// defaultTimelineLimit.
 func RSSHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	w.Header().Set("Access-Control-Allow-Origin", "http://localhost:4321")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 	w.Header().Set("Content-Type", "application/json")
 
 	rctx, span := startSpan(ctx, "handlers.RSSHandler", trace.SpanKindServer)
 	defer span.End()
 	log.Info("connection to /rss established", zap.String("trace_id", span.SpanContext().TraceID().String()))
 
-	feedMutex.RLock()
-	feeds := globalFeed
-	feedMutex.RUnlock()
+	w.Header().Add("Vary", "Accept")
+	format, err := negotiateFormat(r)
+	if err != nil {
+		httpSpanError(span, r.Method, err.Error(), http.StatusBadRequest)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	span.SetAttributes(attribute.String("feed.format", format))
+
+	limit := defaultTimelineLimit
+	if format == formatJSON {
+		limit = 0
+	}
+	q, err := parseTimelineQuery(r, limit)
+	if err != nil {
+		httpSpanError(span, r.Method, err.Error(), http.StatusBadRequest)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	subs := ownedConfig(ctx).activeFeeds()
+	feeds := cachedFeeds(subs)
 
 	// Use cached feeds when available; fall back to a live parse on first request.
-	if feeds == nil {
+	if len(compactFeeds(feeds)) == 0 {
 		log.Info("got null feeds", zap.String("trace_id", span.SpanContext().TraceID().String()))
-		var err error
-		feeds, err = ParseRSS(rctx, getConfigSnapshot().RSSFeeds)
+		urls := make([]string, len(subs))
+		for i, s := range subs {
+			urls[i] = s.URL
+		}
+		feeds, err = parseFeedsAligned(rctx, urls)
 		if err != nil {
 			httpSpanError(span, r.Method, err.Error(), http.StatusBadRequest)
 			w.WriteHeader(http.StatusBadRequest)
@@ -192,7 +280,21 @@ func RSSHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	if err := toJSON(rctx, w, feeds); err != nil {
+	timeline := buildTimeline(subs, feeds, q)
+	page, next := pageTimeline(timeline, q)
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(timeline)))
+	if next != "" {
+		w.Header().Set("X-Next-Cursor", next)
+	}
+	span.SetAttributes(attribute.Int("items.total", len(timeline)))
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	if format != formatJSON {
+		err = writeSyndication(rctx, w, format, newSyndicationPage(r, page, next))
+	} else {
+		err = timelineToJSON(rctx, w, page)
+	}
+	if err != nil {
 		log.Error(err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -40,7 +42,19 @@ const mockRSSFeedContent = `
 
 func TestMain(m *testing.M) {
 	otel.SetTracerProvider(noop.NewTracerProvider())
+	// Keep persistConfig away from the real config path.
+	dir, err := os.MkdirTemp("", "rss-poller-test")
+	if err != nil {
+		panic(err)
+	}
+	// nolint:errcheck
+	os.Setenv("CONFIG_FILE", filepath.Join(dir, "config.json"))
+	// Every mock feed lives on 127.0.0.1; don't space their requests out.
+	// nolint:errcheck
+	os.Setenv("HOST_MIN_DELAY", "0")
 	exitCode := m.Run()
+	// nolint:errcheck
+	os.RemoveAll(dir)
 	os.Exit(exitCode)
 }
 
@@ -59,8 +73,8 @@ func TestConfig(t *testing.T) {
 	}
 
 	expectedFeeds := []string{"https://example.com/rss"}
-	if !reflect.DeepEqual(cfg.RSSFeeds, expectedFeeds) {
-		t.Errorf("Expected feeds: %v, got: %v", expectedFeeds, cfg.RSSFeeds)
+	if got := getConfigSnapshot().feedURLs(); !reflect.DeepEqual(got, expectedFeeds) {
+		t.Errorf("Expected feeds: %v, got: %v", expectedFeeds, got)
 	}
 }
 
@@ -187,7 +201,7 @@ func TestParseRSS(t *testing.T) {
 func TestRSSHandler(t *testing.T) {
 	mockServer := startMockRSSFeedServer()
 	defer mockServer.Close()
-	cfg.RSSFeeds = []string{mockServer.URL}
+	setRSSFeeds([]string{mockServer.URL})
 	req, err := http.NewRequest("GET", "/rss", nil)
 	if err != nil {
 		t.Error(err)
@@ -205,18 +219,22 @@ func TestRSSHandler(t *testing.T) {
 		t.Fatalf("Failed to decode response body: %v", err)
 	}
 
+	sub := getConfigSnapshot().Feeds[0]
+	source := &feedSource{ID: sub.ID, Title: "Test RSS Feed", URL: mockServer.URL}
 	expectedFeeds := []feedsJSON{
 		{
 			Title:       "Test Item 1",
 			Description: "Description for Test Item 1",
 			Content:     "Content for Test Item 1",
 			Link:        "http://example.com/item1",
+			Source:      source,
 		},
 		{
 			Title:       "Test Item 2",
 			Description: "Description for Test Item 2",
 			Content:     "Content for Test Item 2",
 			Link:        "http://example.com/item2",
+			Source:      source,
 		},
 	}
 
@@ -302,7 +320,7 @@ func TestToJSON(t *testing.T) {
 }
 
 func TestRSSHandlerError(t *testing.T) {
-	cfg.RSSFeeds = []string{"http://example.com/rss", "http://notarealrssfeed.com/rss"}
+	setRSSFeeds([]string{"http://example.com/rss", "http://notarealrssfeed.com/rss"})
 	req, err := http.NewRequest("GET", "/rss", nil)
 	if err != nil {
 		t.Error(err)
@@ -326,7 +344,7 @@ func TestHandleConfigPayload(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
 
-		if err := handleConfigPayload(req); err != nil {
+		if _, err := handleConfigPayload(req); err != nil {
 			t.Fatalf("Expected no error, but got: %v", err)
 		}
 	})
@@ -337,7 +355,7 @@ func TestHandleConfigPayload(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/", strings.NewReader(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
 
-		if err := handleConfigPayload(req); err == nil {
+		if _, err := handleConfigPayload(req); err == nil {
 			t.Fatal("Expected an error for invalid method, but got none")
 		}
 	})
@@ -348,7 +366,7 @@ func TestHandleConfigPayload(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(jsonBody))
 		req.Header.Set("Content-Type", "text/plain")
 
-		if err := handleConfigPayload(req); err == nil {
+		if _, err := handleConfigPayload(req); err == nil {
 			t.Fatal("Expected an error for invalid content type, but got none")
 		}
 	})
@@ -359,7 +377,7 @@ func TestHandleConfigPayload(t *testing.T) {
 		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(jsonBody))
 		req.Header.Set("Content-Type", "application/json")
 
-		if err := handleConfigPayload(req); err == nil {
+		if _, err := handleConfigPayload(req); err == nil {
 			t.Fatal("Expected an error for malformed JSON, but got none")
 		}
 	})
@@ -374,12 +392,12 @@ func TestCollectNewLinks(t *testing.T) {
 
 	feeds := []*gofeed.Feed{{Items: []*gofeed.Item{item1, item2}}}
 
-	t.Cleanup(func() { seen = make(map[string]bool) })
+	t.Cleanup(func() { seen = newMemorySeenStore(seenMaxEntries(), seenTTL()) })
 
 	// First call: both items are new — toSend must contain exactly their Links.
 	t.Run("FirstCallReturnsAllLinks", func(t *testing.T) {
-		seen = make(map[string]bool)
-		got := collectNewLinks(context.Background(), feeds)
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+		got, _ := collectNewLinks(context.Background(), "", feeds)
 		want := []string{"http://example.com/item1", "http://example.com/item2"}
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("want %v, got %v", want, got)
@@ -388,7 +406,7 @@ func TestCollectNewLinks(t *testing.T) {
 
 	// Second call with the same feeds: seen is already populated — toSend must be empty.
 	t.Run("SecondCallReturnEmpty", func(t *testing.T) {
-		got := collectNewLinks(context.Background(), feeds)
+		got, _ := collectNewLinks(context.Background(), "", feeds)
 		if len(got) != 0 {
 			t.Errorf("expected empty toSend on second call, got %v", got)
 		}
@@ -397,7 +415,7 @@ func TestCollectNewLinks(t *testing.T) {
 	// New item added to feed: only the new link appears in toSend.
 	t.Run("NewItemOnlyInToSend", func(t *testing.T) {
 		feeds2 := []*gofeed.Feed{{Items: []*gofeed.Item{item1, item2, item3}}}
-		got := collectNewLinks(context.Background(), feeds2)
+		got, _ := collectNewLinks(context.Background(), "", feeds2)
 		want := []string{"http://example.com/item3"}
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("want %v, got %v", want, got)
@@ -406,18 +424,18 @@ func TestCollectNewLinks(t *testing.T) {
 
 	// Item with GUID: dedup key is GUID, but Link is sent in toSend.
 	t.Run("GUIDKeyedItemSendsLink", func(t *testing.T) {
-		seen = make(map[string]bool)
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
 		feeds3 := []*gofeed.Feed{{Items: []*gofeed.Item{itemGUID}}}
-		got := collectNewLinks(context.Background(), feeds3)
+		got, _ := collectNewLinks(context.Background(), "", feeds3)
 		want := []string{"http://example.com/item4"}
 		if !reflect.DeepEqual(got, want) {
 			t.Errorf("want %v, got %v", want, got)
 		}
-		if !seen["tag:example.com,2024:42"] {
+		if !seen.Has("tag:example.com,2024:42") {
 			t.Error("expected GUID to be recorded in seen, not the Link")
 		}
 		// Second call: GUID already seen — nothing sent.
-		got2 := collectNewLinks(context.Background(), feeds3)
+		got2, _ := collectNewLinks(context.Background(), "", feeds3)
 		if len(got2) != 0 {
 			t.Errorf("expected empty on second call for GUID item, got %v", got2)
 		}
@@ -425,25 +443,25 @@ func TestCollectNewLinks(t *testing.T) {
 
 	// Item with GUID but no Link: recorded in seen but never appended to toSend.
 	t.Run("GUIDWithNoLinkNotSent", func(t *testing.T) {
-		seen = make(map[string]bool)
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
 		feeds4 := []*gofeed.Feed{{Items: []*gofeed.Item{itemNoLink}}}
-		got := collectNewLinks(context.Background(), feeds4)
+		got, _ := collectNewLinks(context.Background(), "", feeds4)
 		if len(got) != 0 {
 			t.Errorf("expected nothing sent for item with no link, got %v", got)
 		}
-		if !seen["guid-no-link"] {
+		if !seen.Has("guid-no-link") {
 			t.Error("expected GUID with no link to still be recorded in seen")
 		}
 	})
 
 	// Same URL across multiple feeds in a single cycle: must not duplicate in toSend.
 	t.Run("DuplicateAcrossFeedsInOneCycle", func(t *testing.T) {
-		seen = make(map[string]bool)
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
 		feeds5 := []*gofeed.Feed{
 			{Items: []*gofeed.Item{item1}},
 			{Items: []*gofeed.Item{item1}},
 		}
-		got := collectNewLinks(context.Background(), feeds5)
+		got, _ := collectNewLinks(context.Background(), "", feeds5)
 		if len(got) != 1 {
 			t.Errorf("expected 1 entry for duplicate across feeds, got %v", got)
 		}
@@ -454,34 +472,36 @@ func TestPollAndNotifySeenDedup(t *testing.T) {
 	mockServer := startMockRSSFeedServer()
 	defer mockServer.Close()
 
-	seen = make(map[string]bool)
+	seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
 	globalFeed = nil
-	cfg.RSSFeeds = []string{mockServer.URL}
+	setRSSFeeds([]string{mockServer.URL})
 	if err := os.Unsetenv("NOTIFICATION_ENDPOINT"); err != nil {
 		t.Fatal(err)
 	}
 	t.Cleanup(func() {
 		globalFeed = nil
-		seen = make(map[string]bool)
+		feedCache = make(map[string]*gofeed.Feed)
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
 	})
+	subs := getConfigSnapshot().activeFeeds()
 
-	pollAndNotify(time.Now())
+	pollAndNotify(subs)
 
-	firstSeenCount := len(seen)
+	firstSeenCount := seen.Len()
 	if firstSeenCount == 0 {
 		t.Fatal("expected seen to contain items after first poll")
 	}
 
 	for _, url := range []string{"http://example.com/item1", "http://example.com/item2"} {
-		if !seen[url] {
+		if !seen.Has(url) {
 			t.Errorf("expected seen[%q] to be true after first poll", url)
 		}
 	}
 
-	pollAndNotify(time.Now())
+	pollAndNotify(subs)
 
-	if len(seen) != firstSeenCount {
-		t.Errorf("expected seen count to stay %d after second poll, got %d", firstSeenCount, len(seen))
+	if seen.Len() != firstSeenCount {
+		t.Errorf("expected seen count to stay %d after second poll, got %d", firstSeenCount, seen.Len())
 	}
 }
 
@@ -506,8 +526,44 @@ func TestSendNotification(t *testing.T) {
 			WebHookURL: "http://example.com/webhook",
 		}
 		err := d.sendNotification(context.Background())
-		if err != nil {
-			t.Fatalf("Expected nil when WS is not connected, but got: %v", err)
+		if !errors.Is(err, errNotifyDisconnected) {
+			t.Fatalf("Expected errNotifyDisconnected when WS is not connected, but got: %v", err)
 		}
 	})
 }
+
+func TestPollAndNotifyDisconnected(t *testing.T) {
+	t.Setenv("FEED_BASELINE", "false")
+	mockServer := startMockRSSFeedServer()
+	defer mockServer.Close()
+	wsMu.Lock()
+	wsConn = nil
+	wsMu.Unlock()
+	seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+	setNotificationReceiver("http://example.com/webhook")
+	t.Cleanup(func() {
+		setNotificationReceiver("")
+		feedMutex.Lock()
+		feedCache = make(map[string]*gofeed.Feed)
+		feedMutex.Unlock()
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+	})
+	subs := []Subscription{{ID: "mock", URL: mockServer.URL}}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+
+	feeds := pollAndNotify(subs)
+	links := []string{"http://example.com/item1", "http://example.com/item2"}
+	// The send runs in the background; wait for it to give the keys back.
+	deadline := time.Now().Add(5 * time.Second)
+	for seen.Stats().Pending > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, link := range links {
+		if seen.Has(link) {
+			t.Errorf("expected %s to stay unseen while notify is not connected", link)
+		}
+	}
+	if retried, _ := collectNewLinks(context.Background(), "", feeds); len(retried) != 2 {
+		t.Errorf("expected both items to be retried on the next cycle, got %v", retried)
+	}
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// maxOPMLBytes caps the size of an uploaded OPML document.
+const maxOPMLBytes = 1 << 20
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title,omitempty"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlOutline is either a feed (it has an xmlUrl) or a folder holding more outlines.
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Category string        `xml:"category,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// opmlProblem describes an outline that was not imported.
+type opmlProblem struct {
+	Outline string `json:"outline"`
+	URL     string `json:"url,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// opmlImportResult is the body returned by POST /config/opml.
+type opmlImportResult struct {
+	Added    []Subscription `json:"added"`
+	Problems []opmlProblem  `json:"problems,omitempty"`
+}
+
+// OPMLHandler imports subscriptions from an OPML document on POST and exports
+// the active subscriptions as OPML on GET.
+func OPMLHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		opmlExport(w, r)
+	case http.MethodPost:
+		opmlImport(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+func opmlImport(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.OPMLImportHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to POST /config/opml established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+	w.Header().Set("Content-Type", "application/json")
+
+	// nolint:errcheck
+	defer r.Body.Close()
+	doc, err := decodeOPML(http.MaxBytesReader(w, r.Body, maxOPMLBytes))
+	if err != nil {
+		httpSpanError(span, r.Method, err.Error(), http.StatusBadRequest)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var result opmlImportResult
+	owner := userFrom(ctx)
+	next, diff, err := updateOwnedConfig(ctx, owner, r.Header.Get("If-Match"), func(c *ConfigStruct) error {
+		result = mergeOPML(c, doc, owner)
+		return nil
+	})
+	if err != nil {
+		writeConfigError(w, span, r.Method, err, next.Revision)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int("opml.added", len(result.Added)),
+		attribute.Int("opml.problems", len(result.Problems)),
+	)
+	w.Header().Set("ETag", revisionETag(next.Revision))
+
+	if len(result.Added) == 0 && len(result.Problems) > 0 {
+		recordHTTPSpan(span, r.Method, http.StatusUnprocessableEntity)
+		writeJSON(w, http.StatusUnprocessableEntity, result)
+		return
+	}
+	commitConfigChange(ctx, diff)
+
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func opmlExport(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.OPMLExportHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /config/opml established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	snapshot := ownedConfig(ctx)
+	span.SetAttributes(attribute.Int("feeds.count", len(snapshot.Feeds)))
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="subscriptions.opml"`)
+	w.WriteHeader(http.StatusOK)
+	if err := encodeOPML(w, snapshot, time.Now()); err != nil {
+		spanErrorf(span, err, "failed to encode OPML: %v", err)
+		return
+	}
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+}
+
+// decodeOPML parses an OPML document and rejects anything that is not OPML.
+func decodeOPML(r io.Reader) (opmlDocument, error) {
+	var doc opmlDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return doc, fmt.Errorf("invalid OPML document: %w", err)
+	}
+	if len(doc.Body.Outlines) == 0 {
+		return doc, errors.New("OPML document has no outlines")
+	}
+	return doc, nil
+}
+
+// mergeOPML appends every valid feed outline in doc to c. Folder names become
+// tags on the feeds they contain. Outlines that cannot be imported, because
+// they fail the checks of every other write path or would take c past
+// maxFeeds, are reported in the result rather than dropped silently. New feeds
+// belong to owner.
+func mergeOPML(c *ConfigStruct, doc opmlDocument, owner string) opmlImportResult {
+	var result opmlImportResult
+	var walk func(outlines []opmlOutline, folders []string)
+	walk = func(outlines []opmlOutline, folders []string) {
+		for _, o := range outlines {
+			label := o.label()
+			if o.XMLURL == "" {
+				if len(o.Outlines) == 0 {
+					result.Problems = append(result.Problems, opmlProblem{Outline: label, Reason: "outline has no xmlUrl"})
+					continue
+				}
+				if strings.TrimSpace(label) == "" {
+					walk(o.Outlines, folders)
+				} else {
+					walk(o.Outlines, append(slices.Clone(folders), strings.TrimSpace(label)))
+				}
+				continue
+			}
+
+			feedURL, err := normalizeFeedURL(o.XMLURL)
+			if err != nil {
+				result.Problems = append(result.Problems, opmlProblem{Outline: label, URL: o.XMLURL, Reason: "xmlUrl " + err.Error()})
+				continue
+			}
+			if c.indexByURL(feedURL) >= 0 {
+				result.Problems = append(result.Problems, opmlProblem{Outline: label, URL: feedURL, Reason: "duplicate feed"})
+				continue
+			}
+
+			sub := Subscription{
+				URL:   feedURL,
+				Tags:  o.tags(folders),
+				Owner: owner,
+			}
+			sub.ID = sub.defaultID()
+			if label != o.XMLURL {
+				sub.Name = label
+			}
+			verr := &validationError{}
+			validateSubscription(&sub, "", verr)
+			switch {
+			case len(verr.Problems) > 0:
+				reasons := make([]string, len(verr.Problems))
+				for i, p := range verr.Problems {
+					reasons[i] = p.Field + " " + p.Message
+				}
+				result.Problems = append(result.Problems, opmlProblem{Outline: label, URL: feedURL, Reason: strings.Join(reasons, "; ")})
+				continue
+			case len(c.Feeds) >= maxFeeds:
+				result.Problems = append(result.Problems, opmlProblem{Outline: label, URL: feedURL, Reason: fmt.Sprintf("more than %d feeds", maxFeeds)})
+				continue
+			case c.indexByID(sub.ID) >= 0:
+				result.Problems = append(result.Problems, opmlProblem{Outline: label, URL: feedURL, Reason: "duplicate id " + sub.ID})
+				continue
+			}
+			c.Feeds = append(c.Feeds, sub)
+			result.Added = append(result.Added, sub)
+		}
+	}
+	walk(doc.Body.Outlines, nil)
+	return result
+}
+
+// label returns the human readable name of an outline.
+func (o opmlOutline) label() string {
+	if o.Title != "" {
+		return o.Title
+	}
+	if o.Text != "" {
+		return o.Text
+	}
+	return o.XMLURL
+}
+
+// tags merges the enclosing folder names with the outline's category attribute,
+// which OPML 2.0 defines as a comma separated list of slash delimited paths.
+func (o opmlOutline) tags(folders []string) []string {
+	tags := slices.Clone(folders)
+	for _, c := range strings.Split(o.Category, ",") {
+		for _, part := range strings.Split(c, "/") {
+			if part = strings.TrimSpace(part); part != "" && !slices.Contains(tags, part) {
+				tags = append(tags, part)
+			}
+		}
+	}
+	return tags
+}
+
+// encodeOPML writes c as an OPML 2.0 document. Feeds are nested in a folder
+// named after their first tag; every tag is also listed in the category attribute.
+func encodeOPML(w io.Writer, c ConfigStruct, now time.Time) error {
+	doc := opmlDocument{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       "rss-poller subscriptions",
+			DateCreated: now.UTC().Format(time.RFC1123Z),
+		},
+	}
+
+	folders := make(map[string]int)
+	for _, s := range c.Feeds {
+		o := opmlOutline{
+			Text:   s.URL,
+			Type:   "rss",
+			XMLURL: s.URL,
+		}
+		if s.Name != "" {
+			o.Text, o.Title = s.Name, s.Name
+		}
+		if len(s.Tags) == 0 {
+			doc.Body.Outlines = append(doc.Body.Outlines, o)
+			continue
+		}
+		categories := make([]string, len(s.Tags))
+		for i, t := range s.Tags {
+			categories[i] = "/" + t
+		}
+		o.Category = strings.Join(categories, ",")
+
+		pos, ok := folders[s.Tags[0]]
+		if !ok {
+			pos = len(doc.Body.Outlines)
+			folders[s.Tags[0]] = pos
+			doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{Text: s.Tags[0], Title: s.Tags[0]})
+		}
+		doc.Body.Outlines[pos].Outlines = append(doc.Body.Outlines[pos].Outlines, o)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
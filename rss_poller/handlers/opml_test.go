@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const mockOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="2.0">
+  <head><title>Team feeds</title></head>
+  <body>
+    <outline text="Top level" type="rss" xmlUrl="https://top.example/rss"/>
+    <outline text="Tech">
+      <outline text="Ars" title="Ars Technica" type="rss" xmlUrl="https://ars.example/rss" category="/news"/>
+      <outline text="Nested">
+        <outline text="Deep" type="rss" xmlUrl="https://deep.example/rss"/>
+      </outline>
+    </outline>
+    <outline text="Relative" type="rss" xmlUrl="/feed.xml"/>
+    <outline text="Dup" type="rss" xmlUrl="https://top.example/rss"/>
+    <outline text="Empty"/>
+  </body>
+</opml>`
+
+func TestMergeOPML(t *testing.T) {
+	doc, err := decodeOPML(strings.NewReader(mockOPML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := ConfigStruct{Feeds: subscriptionsFromURLs([]string{"https://existing.example/rss"})}
+	result := mergeOPML(&c, doc, "")
+
+	wantAdded := []Subscription{
+		{ID: feedID("https://top.example/rss"), URL: "https://top.example/rss", Name: "Top level"},
+		{ID: feedID("https://ars.example/rss"), URL: "https://ars.example/rss", Name: "Ars Technica", Tags: []string{"Tech", "news"}},
+		{ID: feedID("https://deep.example/rss"), URL: "https://deep.example/rss", Name: "Deep", Tags: []string{"Tech", "Nested"}},
+	}
+	if !reflect.DeepEqual(result.Added, wantAdded) {
+		t.Errorf("want added %+v, got %+v", wantAdded, result.Added)
+	}
+	if len(c.Feeds) != 4 {
+		t.Errorf("expected 4 subscriptions after merge, got %d", len(c.Feeds))
+	}
+
+	reasons := make(map[string]string)
+	for _, p := range result.Problems {
+		reasons[p.Outline] = p.Reason
+	}
+	for _, outline := range []string{"Relative", "Dup", "Empty"} {
+		if reasons[outline] == "" {
+			t.Errorf("expected outline %q to be reported, got %+v", outline, result.Problems)
+		}
+	}
+}
+
+func TestMergeOPMLValidates(t *testing.T) {
+	long := strings.Repeat("x", maxNameLength+1)
+	doc, err := decodeOPML(strings.NewReader(`<opml version="2.0"><body>
+    <outline text="">
+      <outline text="Unfiled" type="rss" xmlUrl="https://unfiled.example/rss"/>
+    </outline>
+    <outline text="` + long + `" type="rss" xmlUrl="https://long.example/rss"/>
+    <outline text="` + strings.Repeat("t", maxTagLength+1) + `">
+      <outline text="Tagged" type="rss" xmlUrl="https://tagged.example/rss"/>
+    </outline>
+    <outline text="Over" type="rss" xmlUrl="https://over.example/rss"/>
+  </body></opml>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for i := range maxFeeds - 1 {
+		urls = append(urls, fmt.Sprintf("https://feed%d.example/rss", i))
+	}
+	c := ConfigStruct{Feeds: subscriptionsFromURLs(urls)}
+	result := mergeOPML(&c, doc, "")
+
+	if len(result.Added) != 1 || result.Added[0].Name != "Unfiled" || len(result.Added[0].Tags) != 0 {
+		t.Errorf("expected the unfiled feed to be added without an empty tag, got %+v", result.Added)
+	}
+	if len(c.Feeds) != maxFeeds {
+		t.Errorf("expected the import to stop at %d feeds, got %d", maxFeeds, len(c.Feeds))
+	}
+	if err := validateConfig(&c); err != nil {
+		t.Errorf("expected the merged config to be valid, got %v", err)
+	}
+	reasons := make(map[string]string)
+	for _, p := range result.Problems {
+		reasons[p.URL] = p.Reason
+	}
+	for _, u := range []string{"https://long.example/rss", "https://tagged.example/rss"} {
+		if reasons[u] == "" {
+			t.Errorf("expected %s to be reported, got %+v", u, result.Problems)
+		}
+	}
+	if !strings.Contains(reasons["https://over.example/rss"], "more than") {
+		t.Errorf("expected the feed past the cap to be reported, got %+v", result.Problems)
+	}
+}
+
+func TestDecodeOPMLErrors(t *testing.T) {
+	for name, body := range map[string]string{
+		"NotXML":     "not xml at all",
+		"NotOPML":    `<rss version="2.0"><channel></channel></rss>`,
+		"NoOutlines": `<opml version="2.0"><head/><body/></opml>`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decodeOPML(strings.NewReader(body)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestEncodeOPMLRoundTrip(t *testing.T) {
+	c := ConfigStruct{Feeds: []Subscription{
+		{ID: "a", URL: "https://a.example/rss", Name: "A", Tags: []string{"news", "daily"}},
+		{ID: "b", URL: "https://b.example/rss"},
+		{ID: "c", URL: "https://c.example/rss", Tags: []string{"news"}},
+	}}
+	var buf bytes.Buffer
+	if err := encodeOPML(&buf, c, time.Unix(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := decodeOPML(&buf)
+	if err != nil {
+		t.Fatalf("exported OPML does not parse: %v", err)
+	}
+	var imported ConfigStruct
+	result := mergeOPML(&imported, doc, "")
+	if len(result.Problems) != 0 {
+		t.Fatalf("unexpected problems %+v", result.Problems)
+	}
+	got := make(map[string]Subscription)
+	for _, s := range imported.Feeds {
+		got[s.URL] = s
+	}
+	if a := got["https://a.example/rss"]; a.Name != "A" || !reflect.DeepEqual(a.Tags, []string{"news", "daily"}) {
+		t.Errorf("feed a did not round-trip: %+v", a)
+	}
+	if cc := got["https://c.example/rss"]; !reflect.DeepEqual(cc.Tags, []string{"news"}) {
+		t.Errorf("feed c did not round-trip: %+v", cc)
+	}
+	if len(imported.Feeds) != 3 {
+		t.Errorf("expected 3 feeds, got %d", len(imported.Feeds))
+	}
+}
+
+func TestOPMLHandler(t *testing.T) {
+	t.Setenv("CONFIG_FILE", t.TempDir()+"/config.json")
+	setRSSFeeds(nil)
+	t.Cleanup(func() {
+		stopPolling()
+		setRSSFeeds(nil)
+	})
+
+	t.Run("Import", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/config/opml", strings.NewReader(mockOPML))
+		req.Header.Set("Content-Type", "text/x-opml")
+		OPMLHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var result opmlImportResult
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		if len(result.Added) != 3 || len(result.Problems) != 3 {
+			t.Errorf("unexpected import result %+v", result)
+		}
+		if got := len(getConfigSnapshot().Feeds); got != 3 {
+			t.Errorf("expected 3 active subscriptions, got %d", got)
+		}
+	})
+
+	t.Run("ReimportOnlyDuplicates", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		OPMLHandler(rec, httptest.NewRequest(http.MethodPost, "/config/opml", strings.NewReader(mockOPML)))
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected 422 when nothing could be imported, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		OPMLHandler(rec, httptest.NewRequest(http.MethodGet, "/config/opml", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/x-opml") {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		if !strings.Contains(rec.Body.String(), `xmlUrl="https://deep.example/rss"`) {
+			t.Errorf("export is missing an imported feed: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("MethodNotAllowed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		OPMLHandler(rec, httptest.NewRequest(http.MethodDelete, "/config/opml", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected 405, got %d", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// feedTimeout bounds a single feed request once it is allowed to start.
+	feedTimeout = 8 * time.Second
+	// defaultRetryAfter is the backoff used when a 429/503 carries no usable Retry-After.
+	defaultRetryAfter = time.Minute
+	// maxRetryAfter caps how long a host can ask us to stay away.
+	maxRetryAfter = 6 * time.Hour
+)
+
+// errHostBackoff is returned while a host is backing off after a 429 or 503.
+var errHostBackoff = errors.New("host asked us to back off")
+
+// hostState throttles the requests sent to a single host.
+type hostState struct {
+	// slots caps concurrent requests to the host.
+	slots chan struct{}
+
+	mu sync.Mutex
+	// nextSlot is the earliest time the next request may start.
+	nextSlot time.Time
+	// blockedUntil is set from Retry-After when the host answers 429 or 503.
+	blockedUntil time.Time
+}
+
+var (
+	hosts   = make(map[string]*hostState)
+	hostsMu sync.Mutex
+)
+
+// feedUserAgent returns the User-Agent sent with feed and robots.txt requests.
+// USER_AGENT overrides the default.
+func feedUserAgent() string {
+	if v := strings.TrimSpace(os.Getenv("USER_AGENT")); v != "" {
+		return v
+	}
+	return "rss-poller/1.0 (+https://github.com/FKouhai/rss-demo)"
+}
+
+// hostConcurrency returns how many requests may run against one host at a
+// time. HOST_MAX_CONCURRENCY accepts a positive integer.
+func hostConcurrency() int {
+	if v := os.Getenv("HOST_MAX_CONCURRENCY"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+		log.ErrorFmt("invalid HOST_MAX_CONCURRENCY %q, using the default", v)
+	}
+	return 2
+}
+
+// hostMinDelay returns the minimum time between two requests to the same
+// host. HOST_MIN_DELAY accepts a Go duration; "0" disables the rate limit.
+func hostMinDelay() time.Duration {
+	if v := os.Getenv("HOST_MIN_DELAY"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			return d
+		}
+		log.ErrorFmt("invalid HOST_MIN_DELAY %q, using the default", v)
+	}
+	return time.Second
+}
+
+func hostFor(host string) *hostState {
+	host = strings.ToLower(host)
+	hostsMu.Lock()
+	defer hostsMu.Unlock()
+	h, ok := hosts[host]
+	if !ok {
+		h = &hostState{slots: make(chan struct{}, hostConcurrency())}
+		hosts[host] = h
+	}
+	return h
+}
+
+// acquireHost waits until a request to host is allowed by its concurrency cap
+// and rate limit. The returned func releases the slot. It fails fast with
+// errHostBackoff while the host is backing off.
+func acquireHost(ctx context.Context, host string) (func(), error) {
+	h := hostFor(host)
+	if until := h.backoffUntil(); !until.IsZero() {
+		return nil, fmt.Errorf("%w until %s", errHostBackoff, until.Format(time.RFC3339))
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-h.slots }
+
+	h.mu.Lock()
+	now := time.Now()
+	wait := h.nextSlot.Sub(now)
+	h.nextSlot = later(now, h.nextSlot).Add(hostMinDelay())
+	h.mu.Unlock()
+
+	if wait > 0 {
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// backoffUntil returns when the host's backoff ends, or the zero time if it is not backing off.
+func (h *hostState) backoffUntil() time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Now().Before(h.blockedUntil) {
+		return h.blockedUntil
+	}
+	return time.Time{}
+}
+
+// backOffHost makes host wait out a 429 or 503 response, honouring its Retry-After header.
+func backOffHost(host, retryAfterHeader string) time.Duration {
+	d := retryAfter(retryAfterHeader, time.Now())
+	h := hostFor(host)
+	h.mu.Lock()
+	h.blockedUntil = later(h.blockedUntil, time.Now().Add(d))
+	h.mu.Unlock()
+	log.Info("host answered with a retryable status, backing off", zap.String("host", host), zap.Duration("backoff", d))
+	return d
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds
+// or an HTTP date. Missing or invalid values fall back to defaultRetryAfter.
+func retryAfter(header string, now time.Time) time.Duration {
+	header = strings.TrimSpace(header)
+	var d time.Duration
+	if secs, err := strconv.Atoi(header); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(header); err == nil {
+		d = t.Sub(now)
+	} else {
+		return defaultRetryAfter
+	}
+	return min(max(d, 0), maxRetryAfter)
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// resetHosts forgets all per-host state for a test.
+func resetHosts(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		hostsMu.Lock()
+		hosts = make(map[string]*hostState)
+		hostsMu.Unlock()
+		robotsCacheMu.Lock()
+		robotsCache = make(map[string]robotsRules)
+		robotsCacheMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"120":                           2 * time.Minute,
+		"":                              defaultRetryAfter,
+		"soon":                          defaultRetryAfter,
+		"0":                             0,
+		"Thu, 01 Jan 2026 00:05:00 GMT": 5 * time.Minute,
+		"999999":                        maxRetryAfter,
+	}
+	for header, want := range cases {
+		if got := retryAfter(header, now); got != want {
+			t.Errorf("retryAfter(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestAcquireHostConcurrency(t *testing.T) {
+	resetHosts(t)
+	t.Setenv("HOST_MAX_CONCURRENCY", "2")
+
+	var inFlight, maxInFlight atomic.Int32
+	var wg sync.WaitGroup
+	for range 6 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := acquireHost(context.Background(), "a.example")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			n := inFlight.Add(1)
+			for {
+				m := maxInFlight.Load()
+				if n <= m || maxInFlight.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			inFlight.Add(-1)
+			release()
+		}()
+	}
+	wg.Wait()
+	if got := maxInFlight.Load(); got != 2 {
+		t.Errorf("expected at most 2 concurrent requests per host, saw %d", got)
+	}
+}
+
+func TestAcquireHostRateLimit(t *testing.T) {
+	resetHosts(t)
+	t.Setenv("HOST_MIN_DELAY", "50ms")
+
+	start := time.Now()
+	for range 3 {
+		release, err := acquireHost(context.Background(), "b.example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		release()
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected requests to be spaced out, 3 took %v", elapsed)
+	}
+	// Other hosts are not held back.
+	start = time.Now()
+	release, err := acquireHost(context.Background(), "c.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if elapsed := time.Since(start); elapsed > 40*time.Millisecond {
+		t.Errorf("a different host waited %v", elapsed)
+	}
+}
+
+func TestFetchFeedBacksOffOnTooManyRequests(t *testing.T) {
+	resetHosts(t)
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	span := trace.SpanFromContext(context.Background())
+	if _, _, err := fetchFeed(context.Background(), span, server.URL+"/a"); err == nil {
+		t.Fatal("expected the 429 to fail the fetch")
+	}
+	_, _, err := fetchFeed(context.Background(), span, server.URL+"/b")
+	if !errors.Is(err, errHostBackoff) {
+		t.Errorf("expected the host to back off, got %v", err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("expected no request while backing off, got %d", hits.Load())
+	}
+}
+
+func TestFetchFeedUserAgent(t *testing.T) {
+	resetHosts(t)
+	t.Setenv("USER_AGENT", "test-agent/2.0")
+	var got atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.Store(r.UserAgent())
+		// nolint
+		w.Write([]byte(mockRSSFeedContent))
+	}))
+	defer server.Close()
+
+	if _, _, err := fetchFeed(context.Background(), trace.SpanFromContext(context.Background()), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got.Load() != "test-agent/2.0" {
+		t.Errorf("expected the configured User-Agent, got %v", got.Load())
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := `
+# comment
+User-agent: *
+Disallow: /private
+Allow: /private/feed.xml
+
+User-agent: other-bot
+User-agent: rss-poller
+Disallow: /
+Allow: /feeds/*.xml$
+`
+	own := parseRobots(strings.NewReader(robots), "rss-poller/1.0")
+	for path, want := range map[string]bool{
+		"/feeds/news.xml":     true,
+		"/feeds/news.xml?x=1": false,
+		"/private":            false,
+	} {
+		if got := own.allowed(path); got != want {
+			t.Errorf("rss-poller: allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+	generic := parseRobots(strings.NewReader(robots), "someone-else/1.0")
+	for path, want := range map[string]bool{
+		"/private/x":        false,
+		"/private/feed.xml": true,
+		"/public":           true,
+	} {
+		if got := generic.allowed(path); got != want {
+			t.Errorf("*: allowed(%q) = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestFetchFeedRobots(t *testing.T) {
+	resetHosts(t)
+	t.Setenv("ROBOTS_TXT", "true")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			// nolint
+			w.Write([]byte("User-agent: *\nDisallow: /blocked\n"))
+			return
+		}
+		// nolint
+		w.Write([]byte(mockRSSFeedContent))
+	}))
+	defer server.Close()
+
+	span := trace.SpanFromContext(context.Background())
+	if _, _, err := fetchFeed(context.Background(), span, server.URL+"/blocked/rss"); !errors.Is(err, errRobotsDisallowed) {
+		t.Errorf("expected robots.txt to block the feed, got %v", err)
+	}
+	if _, _, err := fetchFeed(context.Background(), span, server.URL+"/open/rss"); err != nil {
+		t.Errorf("expected an allowed feed to be fetched, got %v", err)
+	}
+	u, _ := url.Parse(server.URL)
+	robotsCacheMu.Lock()
+	_, cached := robotsCache["http://"+u.Host]
+	robotsCacheMu.Unlock()
+	if !cached {
+		t.Error("expected robots.txt to be cached per host")
+	}
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// quarantineEntry is a feed that failed too often and is no longer fetched.
+type quarantineEntry struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Name      string    `json:"name,omitempty"`
+	Since     time.Time `json:"since"`
+	Failures  int       `json:"failures"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+var (
+	// quarantine is keyed by feed ID. Entries are dropped when the feed is
+	// removed or its URL changes.
+	quarantine   = make(map[string]quarantineEntry)
+	quarantineMu sync.Mutex
+)
+
+// feedBackoffAfter is how many consecutive failures a feed may have before it
+// is retried with exponential backoff. FEED_BACKOFF_AFTER accepts a positive integer.
+func feedBackoffAfter() int {
+	return envCount("FEED_BACKOFF_AFTER", 3, 1)
+}
+
+// feedQuarantineAfter is how many consecutive failures quarantine a feed.
+// FEED_QUARANTINE_AFTER accepts a non-negative integer; "0" never quarantines.
+func feedQuarantineAfter() int {
+	return envCount("FEED_QUARANTINE_AFTER", 20, 0)
+}
+
+// feedBackoffMax caps the delay between retries of a failing feed.
+// FEED_BACKOFF_MAX accepts a Go duration within the poll_interval bounds.
+func feedBackoffMax() time.Duration {
+	return envInterval("FEED_BACKOFF_MAX", 24*time.Hour)
+}
+
+// quarantineNotify reports whether QUARANTINE_NOTIFY asks for a notification
+// when a feed is quarantined.
+func quarantineNotify() bool {
+	v := os.Getenv("QUARANTINE_NOTIFY")
+	if v == "" {
+		return false
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		log.ErrorFmt("invalid QUARANTINE_NOTIFY %q, quarantine notifications disabled", v)
+	}
+	return on
+}
+
+// envCount reads an integer of at least lo from the environment, falling back to def.
+func envCount(name string, def, lo int) int {
+	if v := os.Getenv(name); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n >= lo {
+			return n
+		}
+		log.Error("invalid count, using the default", zap.String("name", name), zap.String("value", v))
+	}
+	return def
+}
+
+// failureBackoff doubles interval for every failure beyond backoffAfter, up
+// to backoffMax. It returns 0 while the feed has not failed that often.
+func (p pollSettings) failureBackoff(interval time.Duration, failures int) time.Duration {
+	n := failures - p.backoffAfter
+	if n < 0 {
+		return 0
+	}
+	limit := p.backoffMax
+	d := interval
+	for ; n >= 0 && d < limit; n-- {
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+func quarantineFilePath() string {
+	return configFilePath() + ".quarantine.json"
+}
+
+// isQuarantined reports whether s is quarantined.
+func isQuarantined(s Subscription) bool {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	e, ok := quarantine[s.ID]
+	return ok && e.URL == s.URL
+}
+
+// withoutQuarantined returns subs minus the quarantined feeds.
+func withoutQuarantined(subs []Subscription) []Subscription {
+	return slices.DeleteFunc(slices.Clone(subs), isQuarantined)
+}
+
+// pruneQuarantine drops the entries of feeds that are no longer configured or
+// whose URL changed, which deserve a fresh start.
+func pruneQuarantine(ctx context.Context, subs []Subscription) {
+	urls := make(map[string]string, len(subs))
+	for _, s := range subs {
+		urls[s.ID] = s.URL
+	}
+	quarantineMu.Lock()
+	pruned := 0
+	for id, e := range quarantine {
+		if urls[id] != e.URL {
+			delete(quarantine, id)
+			pruned++
+		}
+	}
+	quarantineMu.Unlock()
+	if pruned > 0 {
+		persistQuarantine(ctx)
+	}
+}
+
+// quarantineFailing quarantines the feeds among subs that reached
+// quarantineAfter consecutive failures, and notifies about them once when
+// QUARANTINE_NOTIFY is set.
+func quarantineFailing(ctx context.Context, subs []Subscription, p pollSettings) {
+	threshold := p.quarantineAfter
+	if threshold == 0 {
+		return
+	}
+	ctx, span := startSpan(ctx, "helper.quarantineFailing", trace.SpanKindInternal)
+	defer span.End()
+
+	var added []quarantineEntry
+	var quarantined []Subscription
+	quarantineMu.Lock()
+	for _, s := range subs {
+		st, ok := lookupFeedStatus(s.URL)
+		if !ok || st.ConsecutiveFailures < threshold {
+			continue
+		}
+		if _, ok := quarantine[s.ID]; ok {
+			continue
+		}
+		e := quarantineEntry{ID: s.ID, URL: s.URL, Name: s.Name, Since: time.Now(), Failures: st.ConsecutiveFailures, LastError: st.LastError}
+		quarantine[s.ID] = e
+		added = append(added, e)
+		quarantined = append(quarantined, s)
+	}
+	quarantineMu.Unlock()
+	if len(added) == 0 {
+		return
+	}
+
+	span.SetAttributes(attribute.Int("feeds.quarantined", len(added)))
+	for _, e := range added {
+		log.Error("feed quarantined", zap.String("feed.id", e.ID), zap.String("url", e.URL),
+			zap.Int("failures", e.Failures), zap.String("last_error", e.LastError))
+	}
+	persistQuarantine(ctx)
+
+	if !p.quarantineNotify {
+		return
+	}
+	notifyMu.RLock()
+	defaultReceiver := notificationReceiver
+	notifyMu.RUnlock()
+	notifCtx := trace.ContextWithSpan(context.Background(), span)
+	for i, e := range added {
+		receiver := quarantined[i].receiver(defaultReceiver)
+		if receiver == "" {
+			log.Error("NOTIFICATION_ENDPOINT not set, skipping quarantine notification.")
+			continue
+		}
+		notify := discordNotification{
+			Content:    []string{fmt.Sprintf("Feed %s was quarantined after %d failed fetches: %s", e.URL, e.Failures, e.LastError)},
+			WebHookURL: receiver,
+		}
+		go func() {
+			if err := notify.sendNotification(notifCtx); err != nil {
+				log.ErrorFmt("Failed to send quarantine notification: %v", err)
+			}
+		}()
+	}
+}
+
+// releaseQuarantine re-enables a quarantined feed. Its failures are forgotten
+// so it is fetched again right away instead of after its backoff.
+func releaseQuarantine(ctx context.Context, id string) (quarantineEntry, bool) {
+	quarantineMu.Lock()
+	e, ok := quarantine[id]
+	delete(quarantine, id)
+	quarantineMu.Unlock()
+	if !ok {
+		return e, false
+	}
+	resetFeedFailures(e.URL)
+	persistQuarantine(ctx)
+	return e, true
+}
+
+// loadQuarantine restores the quarantined feeds saved next to the config file.
+func loadQuarantine() {
+	loaded := make(map[string]quarantineEntry)
+	data, err := os.ReadFile(quarantineFilePath())
+	switch {
+	case err == nil:
+		var entries []quarantineEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			log.ErrorFmt("ignoring unreadable quarantine file: %v", err)
+		}
+		for _, e := range entries {
+			loaded[e.ID] = e
+		}
+	case !os.IsNotExist(err):
+		log.ErrorFmt("failed to read quarantine file: %v", err)
+	}
+	quarantineMu.Lock()
+	quarantine = loaded
+	quarantineMu.Unlock()
+}
+
+// quarantineSnapshot returns the quarantined feeds, oldest first.
+func quarantineSnapshot() []quarantineEntry {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	entries := make([]quarantineEntry, 0, len(quarantine))
+	for _, e := range quarantine {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b quarantineEntry) int { return a.Since.Compare(b.Since) })
+	return entries
+}
+
+// persistQuarantine writes the quarantined feeds next to the config file.
+// Like persistConfig it is best-effort.
+func persistQuarantine(ctx context.Context) {
+	_, span := startSpan(ctx, "bootstrap.persistQuarantine", trace.SpanKindInternal)
+	defer span.End()
+
+	data, err := json.Marshal(quarantineSnapshot())
+	if err != nil {
+		span.RecordError(err)
+		return
+	}
+	path := quarantineFilePath()
+	span.SetAttributes(attribute.String("quarantine.path", path))
+	if err := writeFileAtomic(path, data, 0o644); err != nil {
+		span.RecordError(err)
+		log.InfoFmt("quarantine file not writable: %v", err)
+	}
+}
+
+// FeedQuarantineHandler lists the quarantined feeds (GET /feeds/quarantine).
+func FeedQuarantineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.FeedQuarantineHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /feeds/quarantine established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	owned := ownedConfig(ctx).feedIDs()
+	entries := slices.DeleteFunc(quarantineSnapshot(), func(e quarantineEntry) bool { return !owned[e.ID] })
+	span.SetAttributes(attribute.Int("feeds.quarantined", len(entries)))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, map[string][]quarantineEntry{"feeds": entries})
+}
+
+// FeedReleaseHandler takes a feed out of quarantine so it is fetched again
+// (DELETE /feeds/quarantine/{id}).
+func FeedReleaseHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.FeedReleaseHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to DELETE /feeds/quarantine/{id} established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	id := r.PathValue("id")
+	span.SetAttributes(attribute.String("feed.id", id))
+	w.Header().Set("Content-Type", "application/json")
+	var e quarantineEntry
+	ok := ownedConfig(ctx).indexByID(id) >= 0
+	if ok {
+		e, ok = releaseQuarantine(ctx, id)
+	}
+	if !ok {
+		msg := "feed " + id + " is not quarantined"
+		httpSpanError(span, r.Method, msg, http.StatusNotFound)
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": msg})
+		return
+	}
+	log.Info("feed released from quarantine", zap.String("feed.id", e.ID), zap.String("url", e.URL))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	writeJSON(w, http.StatusOK, e)
+}
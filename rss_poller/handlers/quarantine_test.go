@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFailureBackoff(t *testing.T) {
+	t.Setenv("FEED_BACKOFF_AFTER", "3")
+	t.Setenv("FEED_BACKOFF_MAX", "1h")
+	p := pollSettingsFromEnv()
+
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{10, time.Hour},
+		{1000, time.Hour},
+	}
+	for _, c := range cases {
+		if got := p.failureBackoff(time.Minute, c.failures); got != c.want {
+			t.Errorf("failureBackoff(1m, %d) = %v, want %v", c.failures, got, c.want)
+		}
+	}
+}
+
+func TestHostBackoffDoesNotQuarantine(t *testing.T) {
+	resetSchedule(t)
+	resetHosts(t)
+	t.Setenv("POLL_JITTER", "0")
+	t.Setenv("POLL_INTERVAL", "1m")
+	t.Setenv("FEED_BACKOFF_AFTER", "5")
+	t.Setenv("FEED_QUARANTINE_AFTER", "2")
+	p := pollSettingsFromEnv()
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	subs := []Subscription{
+		{ID: "a", URL: server.URL + "/a"},
+		{ID: "b", URL: server.URL + "/b"},
+		{ID: "c", URL: server.URL + "/c"},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+	t.Cleanup(func() {
+		pruneFeedStatuses(nil)
+		quarantineMu.Lock()
+		quarantine = make(map[string]quarantineEntry)
+		quarantineMu.Unlock()
+		// nolint:errcheck
+		os.Remove(quarantineFilePath())
+	})
+
+	now := time.Now()
+	for i := range 6 {
+		pollDue(now.Add(time.Duration(i)*time.Minute), p)
+	}
+	// Fetches already waiting for the host when the 429 came in may get one too.
+	if got := hits.Load(); got == 0 || got > int32(len(subs)) {
+		t.Errorf("expected the host to be asked at most once per feed while backing off, got %d requests", got)
+	}
+	for _, s := range subs {
+		if isQuarantined(s) {
+			t.Errorf("expected %s not to be quarantined while its host backs off", s.ID)
+		}
+		st, _ := lookupFeedStatus(s.URL)
+		if st.ConsecutiveFailures > 1 {
+			t.Errorf("expected host backoff not to count as failures of %s, got %d", s.ID, st.ConsecutiveFailures)
+		}
+		if !strings.Contains(st.LastError, errHostBackoff.Error()) {
+			t.Errorf("expected %s to report the host backoff, got %q", s.ID, st.LastError)
+		}
+	}
+}
+
+func TestQuarantineLifecycle(t *testing.T) {
+	resetSchedule(t)
+	t.Setenv("POLL_JITTER", "0")
+	t.Setenv("FEED_BACKOFF_AFTER", "5")
+	t.Setenv("FEED_QUARANTINE_AFTER", "2")
+	p := pollSettingsFromEnv()
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer server.Close()
+
+	resetConfig(t, ConfigStruct{Feeds: []Subscription{{ID: "dead", URL: server.URL}}})
+	t.Cleanup(func() {
+		pruneFeedStatuses(nil)
+		quarantineMu.Lock()
+		quarantine = make(map[string]quarantineEntry)
+		quarantineMu.Unlock()
+		// nolint:errcheck
+		os.Remove(quarantineFilePath())
+	})
+
+	now := time.Now()
+	for i := range 4 {
+		pollDue(now.Add(time.Duration(i)*time.Minute), p)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("expected the feed to stop being fetched after 2 failures, fetched %d times", got)
+	}
+
+	list := func() []quarantineEntry {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		FeedQuarantineHandler(rr, httptest.NewRequest(http.MethodGet, "/feeds/quarantine", nil))
+		var body struct {
+			Feeds []quarantineEntry `json:"feeds"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Feeds
+	}
+	entries := list()
+	if len(entries) != 1 || entries[0].ID != "dead" || entries[0].Failures != 2 || entries[0].LastError == "" {
+		t.Fatalf("unexpected quarantined feeds: %+v", entries)
+	}
+
+	// The quarantine survives a restart.
+	quarantineMu.Lock()
+	quarantine = make(map[string]quarantineEntry)
+	quarantineMu.Unlock()
+	loadQuarantine()
+	if !isQuarantined(Subscription{ID: "dead", URL: server.URL}) {
+		t.Fatal("expected the quarantine to be restored from disk")
+	}
+
+	// Disabling and re-enabling the feed does not release it.
+	for _, disabled := range []bool{true, false} {
+		resetConfig(t, ConfigStruct{Feeds: []Subscription{{ID: "dead", URL: server.URL, Disabled: disabled}}})
+		pollDue(now.Add(5*time.Minute), p)
+	}
+	if !isQuarantined(Subscription{ID: "dead", URL: server.URL}) || hits.Load() != 2 {
+		t.Fatalf("expected the feed to stay quarantined while disabled, fetched %d times", hits.Load())
+	}
+
+	release := func() int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodDelete, "/feeds/quarantine/dead", nil)
+		req.SetPathValue("id", "dead")
+		rr := httptest.NewRecorder()
+		FeedReleaseHandler(rr, req)
+		return rr.Code
+	}
+	if code := release(); code != http.StatusOK {
+		t.Fatalf("expected 200 releasing the feed, got %d", code)
+	}
+	if code := release(); code != http.StatusNotFound {
+		t.Errorf("expected 404 releasing a feed that is not quarantined, got %d", code)
+	}
+	if len(list()) != 0 {
+		t.Error("expected the released feed to leave the quarantine")
+	}
+
+	pollDue(now.Add(10*time.Minute), p)
+	if got := hits.Load(); got != 3 {
+		t.Errorf("expected the released feed to be fetched again, fetched %d times", got)
+	}
+	if isQuarantined(Subscription{ID: "dead", URL: server.URL}) {
+		t.Error("expected a single failure after release not to quarantine the feed again")
+	}
+}
+
+func TestQuarantineDroppedWhenURLChanges(t *testing.T) {
+	quarantineMu.Lock()
+	quarantine = map[string]quarantineEntry{"feed": {ID: "feed", URL: "http://old.example/feed"}}
+	quarantineMu.Unlock()
+	t.Cleanup(func() {
+		quarantineMu.Lock()
+		quarantine = make(map[string]quarantineEntry)
+		quarantineMu.Unlock()
+		// nolint:errcheck
+		os.Remove(quarantineFilePath())
+	})
+
+	moved := Subscription{ID: "feed", URL: "http://new.example/feed"}
+	if isQuarantined(moved) {
+		t.Error("expected a feed with a new URL not to be quarantined")
+	}
+	pruneQuarantine(t.Context(), []Subscription{moved})
+	if n := len(quarantineSnapshot()); n != 0 {
+		t.Errorf("expected the stale entry to be pruned, %d left", n)
+	}
+}
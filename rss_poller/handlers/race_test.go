@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"sync"
 	"testing"
 	"time"
@@ -13,7 +14,7 @@ func TestConcurrentConfigUpdatesDuringPolling(t *testing.T) {
 	mockServer := startMockRSSFeedServer()
 	defer mockServer.Close()
 
-	cfg.RSSFeeds = []string{mockServer.URL}
+	setRSSFeeds([]string{mockServer.URL})
 
 	startPolling()
 	defer func() {
@@ -25,11 +26,11 @@ func TestConcurrentConfigUpdatesDuringPolling(t *testing.T) {
 	time.Sleep(100 * time.Millisecond)
 
 	// Now hammer concurrent config updates while the ticker is running.
-	// Each POST /config calls handleConfigPayload -> startPolling,
-	// which writes to global ticker/cancelFn (line 413-439).
+	// Each POST /config calls updateConfig -> reconcilePolling,
+	// which may write to global ticker/cancelFn.
 	//
 	// This creates a race:
-	// - Goroutine 1 (ticker): reads cfg.RSSFeeds in pollAndNotify
+	// - Goroutine 1 (ticker): reads cfg.Feeds in pollAndNotify
 	// - Goroutines 2-N (HTTP handlers): write cfg + modify ticker/cancelFn in startPolling
 	//
 	// The race detector will catch concurrent reads/writes to ticker, cancelFn, and cfg.
@@ -53,10 +54,11 @@ func TestConcurrentConfigUpdatesDuringPolling(t *testing.T) {
 			}
 			req.Header.Set("Content-Type", "application/json")
 
-			err = handleConfigPayload(req)
-			if err != nil {
+			rec := httptest.NewRecorder()
+			ConfigHandler(rec, req)
+			if rec.Code != http.StatusOK {
 				// Config errors are OK; we're testing for races, not success
-				t.Logf("config update %d returned error (expected): %v", iteration, err)
+				t.Logf("config update %d returned status %d", iteration, rec.Code)
 			}
 		}(i)
 	}
@@ -74,7 +76,7 @@ func TestCfgRSSFeedsRaceDuringPoll(t *testing.T) {
 	mockServer := startMockRSSFeedServer()
 	defer mockServer.Close()
 
-	cfg.RSSFeeds = []string{mockServer.URL}
+	setRSSFeeds([]string{mockServer.URL})
 	globalFeed = nil
 
 	startPolling()
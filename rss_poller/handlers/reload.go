@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var (
+	// configFileHash is the content hash of the config file as last loaded or written.
+	configFileHash   [sha256.Size]byte
+	configFileHashMu sync.Mutex
+)
+
+func setConfigFileHash(data []byte) {
+	configFileHashMu.Lock()
+	configFileHash = sha256.Sum256(data)
+	configFileHashMu.Unlock()
+}
+
+// configFileChanged reports whether data differs from what was last loaded or written.
+func configFileChanged(data []byte) bool {
+	configFileHashMu.Lock()
+	defer configFileHashMu.Unlock()
+	return sha256.Sum256(data) != configFileHash
+}
+
+// configReloadInterval returns how often WatchConfig checks the config file.
+// CONFIG_RELOAD_INTERVAL accepts a Go duration; "0" disables hot reload.
+func configReloadInterval() time.Duration {
+	if v := os.Getenv("CONFIG_RELOAD_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			return d
+		}
+		log.ErrorFmt("invalid CONFIG_RELOAD_INTERVAL %q, using the default", v)
+	}
+	return 10 * time.Second
+}
+
+// readConfigFile reads and parses the config file at path and remembers its
+// content hash so WatchConfig only reacts to real changes. Feeds validateConfig
+// would reject are dropped and logged, at startup and on reload alike, so a
+// single bad entry does not stop the others from being polled. The file itself
+// is only rewritten by changes made through the API.
+func readConfigFile(path string) (ConfigStruct, error) {
+	var loaded ConfigStruct
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return loaded, err
+	}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return loaded, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	for _, p := range dropInvalidFeeds(&loaded) {
+		log.Error("ignoring invalid feed in config file", zap.String("field", p.Field), zap.String("problem", p.Message))
+	}
+	setConfigFileHash(data)
+	return loaded, nil
+}
+
+// WatchConfig re-reads CONFIG_FILE every CONFIG_RELOAD_INTERVAL and applies it
+// when its content changes. The file is re-opened by path on every check, so the
+// symlink swap Kubernetes uses to update ConfigMap volumes is picked up like
+// any other edit. It returns when ctx is cancelled.
+func WatchConfig(ctx context.Context) {
+	interval := configReloadInterval()
+	if interval == 0 {
+		log.Info("config hot reload disabled")
+		return
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			reloadConfig(ctx)
+		}
+	}
+}
+
+// reloadConfig applies the config file if it changed since it was last seen.
+// An unreadable file is reported and the running config is kept. Feeds whose
+// URL or settings changed are rescheduled as if they had just been added.
+func reloadConfig(ctx context.Context) {
+	path := configFilePath()
+	data, err := os.ReadFile(path)
+	if err != nil || !configFileChanged(data) {
+		return
+	}
+
+	ctx, span := startSpan(ctx, "bootstrap.ReloadConfig", trace.SpanKindInternal)
+	defer span.End()
+	span.SetAttributes(attribute.String("config.path", path))
+
+	loaded, err := readConfigFile(path)
+	if err != nil {
+		// Remember the broken content so it is reported once, not on every tick.
+		setConfigFileHash(data)
+		spanErrorf(span, err, "config reload rejected, keeping the running config: %v", err)
+		return
+	}
+
+	next, diff, err := updateConfig(ctx, "", func(c *ConfigStruct) error {
+		c.Feeds = loaded.Feeds
+		return nil
+	})
+	if err != nil {
+		spanErrorf(span, err, "config reload failed: %v", err)
+		return
+	}
+	span.SetAttributes(
+		attribute.Int64("config.revision", int64(next.Revision)),
+		attribute.Int("feeds.added", len(diff.Added)),
+		attribute.Int("feeds.removed", len(diff.Removed)),
+		attribute.Int("feeds.updated", len(diff.Updated)),
+	)
+	log.Info("reloaded config file",
+		zap.String("trace_id", span.SpanContext().TraceID().String()),
+		zap.String("config.path", path),
+		zap.Uint64("config.revision", next.Revision),
+		zap.Int("feeds.added", len(diff.Added)),
+		zap.Int("feeds.removed", len(diff.Removed)),
+		zap.Int("feeds.updated", len(diff.Updated)))
+
+	// The file is the source of this change, so only the history is written back.
+	if !diff.empty() {
+		persistHistory(ctx)
+		resetSchedules(diff.Updated)
+		reconcilePolling()
+	}
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReloadConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	t.Setenv("CONFIG_FILE", path)
+	resetConfig(t, ConfigStruct{})
+
+	write := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`{"feeds": [{"id": "a", "url": "https://a.example/rss"}]}`)
+	reloadConfig(t.Context())
+	first := getConfigSnapshot()
+	if len(first.Feeds) != 1 || first.Feeds[0].ID != "a" {
+		t.Fatalf("expected the file to be applied, got %+v", first)
+	}
+
+	t.Run("UnchangedFileIsIgnored", func(t *testing.T) {
+		reloadConfig(t.Context())
+		if got := getConfigSnapshot().Revision; got != first.Revision {
+			t.Errorf("expected revision %d, got %d", first.Revision, got)
+		}
+	})
+
+	t.Run("UnreadableFileKeepsRunningConfig", func(t *testing.T) {
+		write(`{"feeds": [{"url": "https://b.example/rss"}`)
+		reloadConfig(t.Context())
+		if got := getConfigSnapshot(); got.Revision != first.Revision || got.Feeds[0].URL != "https://a.example/rss" {
+			t.Errorf("unreadable file must not be applied, got %+v", got)
+		}
+	})
+
+	t.Run("InvalidFeedsAreDropped", func(t *testing.T) {
+		write(`{"feeds": [{"id": "a", "url": "https://a.example/rss"}, {"url": "ftp://b.example/rss"}]}`)
+		reloadConfig(t.Context())
+		if got := getConfigSnapshot(); got.Revision != first.Revision || len(got.Feeds) != 1 || got.Feeds[0].ID != "a" {
+			t.Errorf("expected only the invalid feed to be dropped, got %+v", got)
+		}
+	})
+
+	t.Run("ChangedFeedsAreRescheduled", func(t *testing.T) {
+		resetSchedule(t)
+		p := pollSettingsFromEnv()
+		dueFeeds(time.Now(), getConfigSnapshot().Feeds, p)
+		write(`{"feeds": [{"id": "a", "url": "https://a.example/moved"}]}`)
+		reloadConfig(t.Context())
+		scheduleMu.Lock()
+		_, ok := schedule["a"]
+		scheduleMu.Unlock()
+		if ok {
+			t.Error("expected the schedule of the changed feed to be reset")
+		}
+	})
+
+	t.Run("OwnWritesAreIgnored", func(t *testing.T) {
+		write(`{"feeds": [{"id": "a", "url": "https://a.example/rss"}]}`)
+		reloadConfig(t.Context())
+		rev := getConfigSnapshot().Revision
+		persistConfig(t.Context())
+		reloadConfig(t.Context())
+		if got := getConfigSnapshot().Revision; got != rev {
+			t.Errorf("persistConfig output was reloaded: revision %d -> %d", rev, got)
+		}
+	})
+}
+
+// TestReloadConfigSymlinkSwap mimics how Kubernetes updates a mounted ConfigMap:
+// config.json -> ..data/config.json, and ..data is atomically re-pointed to a new directory.
+func TestReloadConfigSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	mkVersion := func(name, body string) {
+		t.Helper()
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name, "config.json"), []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	swap := func(name string) {
+		t.Helper()
+		tmp := filepath.Join(dir, "..data_tmp")
+		if err := os.Symlink(name, tmp); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, filepath.Join(dir, "..data")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	mkVersion("..v1", `{"feeds": [{"id": "a", "url": "https://a.example/rss"}]}`)
+	mkVersion("..v2", `{"feeds": [{"id": "a", "url": "https://a.example/rss"}, {"id": "b", "url": "https://b.example/rss"}]}`)
+	swap("..v1")
+	path := filepath.Join(dir, "config.json")
+	if err := os.Symlink(filepath.Join("..data", "config.json"), path); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	resetConfig(t, ConfigStruct{})
+
+	reloadConfig(t.Context())
+	if got := len(getConfigSnapshot().Feeds); got != 1 {
+		t.Fatalf("expected 1 feed from ..v1, got %d", got)
+	}
+
+	swap("..v2")
+	reloadConfig(t.Context())
+	if got := len(getConfigSnapshot().Feeds); got != 2 {
+		t.Errorf("expected 2 feeds after the symlink swap, got %d", got)
+	}
+}
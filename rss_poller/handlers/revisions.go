@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// errRevisionNotFound is returned when a revision is no longer (or never was) in the history.
+var errRevisionNotFound = errors.New("revision not found")
+
+// configRevision is a single entry of the config history.
+type configRevision struct {
+	Revision  uint64         `json:"revision"`
+	Timestamp time.Time      `json:"timestamp"`
+	TraceID   string         `json:"trace_id,omitempty"`
+	Feeds     []Subscription `json:"feeds"`
+}
+
+// ownedBy returns the revision as seen by owner.
+func (r configRevision) ownedBy(owner string) configRevision {
+	r.Feeds = ConfigStruct{Feeds: r.Feeds}.ownedBy(owner).Feeds
+	return r
+}
+
+// configRevisionSummary is how a revision is listed, without its feeds.
+type configRevisionSummary struct {
+	Revision  uint64    `json:"revision"`
+	Timestamp time.Time `json:"timestamp"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	FeedCount int       `json:"feed_count"`
+}
+
+var (
+	// history holds the last configHistorySize() revisions, oldest first.
+	history   []configRevision
+	historyMu sync.Mutex
+)
+
+// configHistorySize returns how many revisions are kept.
+// CONFIG_HISTORY_SIZE accepts a positive integer.
+func configHistorySize() int {
+	if v := os.Getenv("CONFIG_HISTORY_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+		log.ErrorFmt("invalid CONFIG_HISTORY_SIZE %q, using the default", v)
+	}
+	return 20
+}
+
+// historyFilePath is where the history is persisted, next to the config file.
+func historyFilePath() string {
+	return configFilePath() + ".history.json"
+}
+
+// recordRevision appends c to the history, tagged with the trace ID found in ctx.
+func recordRevision(ctx context.Context, c ConfigStruct) {
+	entry := configRevision{
+		Revision:  c.Revision,
+		Timestamp: time.Now().UTC(),
+		Feeds:     c.clone().Feeds,
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		entry.TraceID = sc.TraceID().String()
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if n := len(history); n > 0 && history[n-1].Revision >= entry.Revision {
+		// A revision number is never reused, so anything newer is stale.
+		history = slices.DeleteFunc(history, func(h configRevision) bool { return h.Revision >= entry.Revision })
+	}
+	history = append(history, entry)
+	if over := len(history) - configHistorySize(); over > 0 {
+		history = slices.Delete(history, 0, over)
+	}
+}
+
+// lookupRevision returns a copy of the history entry for rev.
+func lookupRevision(rev uint64) (configRevision, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	for _, h := range history {
+		if h.Revision == rev {
+			h.Feeds = ConfigStruct{Feeds: h.Feeds}.clone().Feeds
+			return h, nil
+		}
+	}
+	return configRevision{}, fmt.Errorf("%w: %d", errRevisionNotFound, rev)
+}
+
+// loadHistory reads the persisted history, if any, and makes sure the loaded
+// config is its newest entry. It returns current with the revision it is
+// recorded under: the newest entry's when the content matches it, and a new
+// number after every entry when the file was edited while the service was
+// down, whatever revision the file claims.
+func loadHistory(ctx context.Context, current ConfigStruct) ConfigStruct {
+	var loaded []configRevision
+	data, err := os.ReadFile(historyFilePath())
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &loaded); err != nil {
+			log.ErrorFmt("ignoring unreadable config history: %v", err)
+			loaded = nil
+		}
+	case !os.IsNotExist(err):
+		log.ErrorFmt("failed to read config history: %v", err)
+	}
+
+	historyMu.Lock()
+	history = loaded
+	historyMu.Unlock()
+
+	n := len(loaded)
+	if n == 0 {
+		recordRevision(ctx, current)
+		return current
+	}
+	if diffConfig(ConfigStruct{Feeds: loaded[n-1].Feeds}, current).empty() {
+		current.Revision = loaded[n-1].Revision
+		return current
+	}
+	var newest uint64
+	for _, h := range loaded {
+		newest = max(newest, h.Revision)
+	}
+	current.Revision = newest + 1
+	recordRevision(ctx, current)
+	persistHistory(ctx)
+	return current
+}
+
+// persistHistory writes the history next to the config file. Like
+// persistConfig it is best-effort.
+func persistHistory(ctx context.Context) {
+	_, span := startSpan(ctx, "bootstrap.persistHistory", trace.SpanKindInternal)
+	defer span.End()
+
+	historyMu.Lock()
+	data, err := json.Marshal(history)
+	historyMu.Unlock()
+	if err != nil {
+		span.RecordError(err)
+		return
+	}
+	path := historyFilePath()
+	span.SetAttributes(attribute.String("config.history_path", path))
+	if err := writeFileAtomic(path, data, 0o644); err != nil {
+		span.RecordError(err)
+		log.InfoFmt("config history not writable: %v", err)
+	}
+}
+
+// writeFileAtomic replaces path with data so readers see either the old or the
+// new content, never a partial write: the data goes to a temporary file in the
+// same directory, is fsynced, renamed over path, and the directory is fsynced.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	// Removing a renamed temp file fails harmlessly.
+	// nolint:errcheck
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		// nolint:errcheck
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		// nolint:errcheck
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	// nolint:errcheck
+	defer d.Close()
+	return d.Sync()
+}
+
+// ConfigRevisionsHandler lists the kept config revisions, newest first (GET /config/revisions).
+func ConfigRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.ConfigRevisionsHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /config/revisions established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	owner := userFrom(ctx)
+	historyMu.Lock()
+	list := make([]configRevisionSummary, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		h := history[i].ownedBy(owner)
+		list = append(list, configRevisionSummary{Revision: h.Revision, Timestamp: h.Timestamp, TraceID: h.TraceID, FeedCount: len(h.Feeds)})
+	}
+	historyMu.Unlock()
+
+	span.SetAttributes(attribute.Int("config.revisions", len(list)))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, map[string]any{"revisions": list})
+}
+
+// ConfigRevisionHandler returns a single revision with its feeds (GET /config/revisions/{rev}).
+func ConfigRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.ConfigRevisionHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /config/revisions/{rev} established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	entry, err := revisionFromPath(r, "rev")
+	if err != nil {
+		writeRevisionError(w, span, r.Method, err)
+		return
+	}
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, entry.ownedBy(userFrom(ctx)))
+}
+
+// ConfigRevisionDiffHandler compares two kept revisions
+// (GET /config/revisions/diff?from=N&to=M). "to" defaults to the current revision.
+func ConfigRevisionDiffHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.ConfigRevisionDiffHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /config/revisions/diff established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	q := r.URL.Query()
+	if q.Get("to") == "" {
+		q.Set("to", strconv.FormatUint(getConfigSnapshot().Revision, 10))
+	}
+	from, err := lookupRevisionParam(q.Get("from"), "from")
+	if err != nil {
+		writeRevisionError(w, span, r.Method, err)
+		return
+	}
+	to, err := lookupRevisionParam(q.Get("to"), "to")
+	if err != nil {
+		writeRevisionError(w, span, r.Method, err)
+		return
+	}
+
+	owner := userFrom(ctx)
+	from, to = from.ownedBy(owner), to.ownedBy(owner)
+	span.SetAttributes(attribute.Int64("config.diff.from", int64(from.Revision)), attribute.Int64("config.diff.to", int64(to.Revision)))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, struct {
+		From uint64 `json:"from"`
+		To   uint64 `json:"to"`
+		configDiff
+	}{From: from.Revision, To: to.Revision, configDiff: diffConfig(ConfigStruct{Feeds: from.Feeds}, ConfigStruct{Feeds: to.Feeds})})
+}
+
+// ConfigRollbackHandler makes the feeds of an earlier revision current again
+// (POST /config/revisions/{rev}/rollback). The rollback is a new revision, so it
+// honours If-Match and can itself be rolled back.
+func ConfigRollbackHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.ConfigRollbackHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to POST /config/revisions/{rev}/rollback established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	entry, err := revisionFromPath(r, "rev")
+	if err != nil {
+		writeRevisionError(w, span, r.Method, err)
+		return
+	}
+	span.SetAttributes(attribute.Int64("config.rollback_to", int64(entry.Revision)))
+
+	owner := userFrom(ctx)
+	next, diff, err := updateOwnedConfig(ctx, owner, r.Header.Get("If-Match"), func(c *ConfigStruct) error {
+		c.Feeds = entry.ownedBy(owner).Feeds
+		return nil
+	})
+	if err != nil {
+		writeConfigError(w, span, r.Method, err, next.Revision)
+		return
+	}
+	commitConfigChange(ctx, diff)
+
+	log.Info("rolled back config",
+		zap.String("trace_id", span.SpanContext().TraceID().String()),
+		zap.Uint64("config.rollback_to", entry.Revision),
+		zap.Uint64("config.revision", next.Revision))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", revisionETag(next.Revision))
+	writeJSON(w, http.StatusOK, configChangeResponse{Revision: next.Revision, configDiff: diff})
+}
+
+func revisionFromPath(r *http.Request, name string) (configRevision, error) {
+	return lookupRevisionParam(r.PathValue(name), name)
+}
+
+// lookupRevisionParam parses a revision number named name and looks it up in the history.
+func lookupRevisionParam(raw, name string) (configRevision, error) {
+	rev, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return configRevision{}, fmt.Errorf("%s must be a revision number", name)
+	}
+	return lookupRevision(rev)
+}
+
+// writeRevisionError reports a bad or unknown revision.
+func writeRevisionError(w http.ResponseWriter, span trace.Span, method string, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, errRevisionNotFound) {
+		status = http.StatusNotFound
+	}
+	httpSpanError(span, method, err.Error(), status)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	for _, content := range []string{`{"revision":1}`, `{"revision":2}`} {
+		if err := writeFileAtomic(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil || string(got) != content {
+			t.Fatalf("read back %q, %v; want %q", got, err, content)
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files were left behind: %v", entries)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o644 {
+		t.Errorf("unexpected file mode %v, %v", info.Mode(), err)
+	}
+}
+
+func TestRecordRevisionTrimsHistory(t *testing.T) {
+	resetConfig(t, ConfigStruct{})
+	t.Setenv("CONFIG_HISTORY_SIZE", "3")
+	for rev := uint64(1); rev <= 5; rev++ {
+		recordRevision(context.Background(), ConfigStruct{Revision: rev})
+	}
+	if _, err := lookupRevision(2); err == nil {
+		t.Error("expected revision 2 to be trimmed")
+	}
+	if _, err := lookupRevision(5); err != nil {
+		t.Errorf("expected revision 5 to be kept: %v", err)
+	}
+}
+
+func TestHistoryPersistence(t *testing.T) {
+	resetConfig(t, ConfigStruct{})
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "config.json"))
+
+	updateFeeds := func(urls ...string) {
+		t.Helper()
+		_, diff, err := updateConfig(context.Background(), "", func(c *ConfigStruct) error {
+			c.Feeds = subscriptionsFromURLs(urls)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		commitConfigChange(context.Background(), diff)
+	}
+	updateFeeds("https://a.example/rss")
+	updateFeeds("https://a.example/rss", "https://b.example/rss")
+	stopPolling()
+
+	historyMu.Lock()
+	history = nil
+	historyMu.Unlock()
+	loaded, err := readConfigFile(configFilePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadHistory(context.Background(), loaded)
+
+	entry, err := lookupRevision(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Feeds) != 1 || entry.Feeds[0].URL != "https://a.example/rss" {
+		t.Errorf("unexpected revision 1 after reload: %+v", entry)
+	}
+	if _, err := lookupRevision(2); err != nil {
+		t.Errorf("expected the loaded revision in the history: %v", err)
+	}
+	if got := loadHistory(context.Background(), loaded); got.Revision != 2 {
+		t.Errorf("expected an unchanged file to keep revision 2, got %d", got.Revision)
+	}
+
+	// Hand edits that keep an old revision, or have none, get a new one.
+	for _, c := range []struct {
+		fileRev, want uint64
+		url           string
+	}{
+		{1, 3, "https://c.example/rss"},
+		{0, 4, "https://d.example/rss"},
+	} {
+		got := loadHistory(context.Background(), ConfigStruct{Revision: c.fileRev, Feeds: subscriptionsFromURLs([]string{c.url})})
+		if got.Revision != c.want {
+			t.Errorf("file revision %d: expected the edited file to become revision %d, got %d", c.fileRev, c.want, got.Revision)
+		}
+		if entry, err := lookupRevision(1); err != nil || entry.Feeds[0].URL != "https://a.example/rss" {
+			t.Errorf("file revision %d: expected revision 1 to be kept, got %+v, %v", c.fileRev, entry, err)
+		}
+	}
+}
+
+func TestConfigRollback(t *testing.T) {
+	resetConfig(t, ConfigStruct{})
+	for _, urls := range [][]string{
+		{"https://a.example/rss"},
+		{"https://a.example/rss", "https://b.example/rss"},
+		{"https://c.example/rss"},
+	} {
+		if _, _, err := updateConfig(context.Background(), "", func(c *ConfigStruct) error {
+			c.Feeds = subscriptionsFromURLs(urls)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("List", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ConfigRevisionsHandler(rec, httptest.NewRequest(http.MethodGet, "/config/revisions", nil))
+		var resp struct {
+			Revisions []configRevisionSummary `json:"revisions"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Revisions) != 3 || resp.Revisions[0].Revision != 3 || resp.Revisions[1].FeedCount != 2 {
+			t.Errorf("unexpected revision list %+v", resp.Revisions)
+		}
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		ConfigRevisionDiffHandler(rec, httptest.NewRequest(http.MethodGet, "/config/revisions/diff?from=1", nil))
+		var resp configDiff
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Added) != 1 || resp.Added[0].URL != "https://c.example/rss" || len(resp.Removed) != 1 {
+			t.Errorf("unexpected diff %+v", resp)
+		}
+	})
+
+	t.Run("UnknownRevision", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/config/revisions/42/rollback", nil)
+		req.SetPathValue("rev", "42")
+		rec := httptest.NewRecorder()
+		ConfigRollbackHandler(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("StaleRevision", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/config/revisions/2/rollback", nil)
+		req.SetPathValue("rev", "2")
+		req.Header.Set("If-Match", `"2"`)
+		rec := httptest.NewRecorder()
+		ConfigRollbackHandler(rec, req)
+		if rec.Code != http.StatusPreconditionFailed {
+			t.Errorf("expected 412, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Rollback", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/config/revisions/2/rollback", nil)
+		req.SetPathValue("rev", "2")
+		req.Header.Set("If-Match", `"3"`)
+		rec := httptest.NewRecorder()
+		ConfigRollbackHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		resp := decodeChange(t, rec)
+		if resp.Revision != 4 || len(resp.Added) != 2 || len(resp.Removed) != 1 {
+			t.Errorf("unexpected response %+v", resp)
+		}
+		if got := getConfigSnapshot().feedURLs(); len(got) != 2 {
+			t.Errorf("rollback did not restore revision 2: %v", got)
+		}
+	})
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// robotsTTL is how long a fetched robots.txt is trusted.
+	robotsTTL = 24 * time.Hour
+	// robotsRetry is how long a robots.txt that could not be fetched counts as "allow all".
+	robotsRetry = time.Hour
+	// maxRobotsBytes caps the robots.txt body, as RFC 9309 allows.
+	maxRobotsBytes = 500 << 10
+)
+
+// errRobotsDisallowed is returned when robots.txt forbids fetching a feed.
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// robotsRule is a single Allow or Disallow line.
+type robotsRule struct {
+	allow   bool
+	length  int
+	pattern *regexp.Regexp
+}
+
+// robotsRules are the rules of robots.txt that apply to our User-Agent.
+type robotsRules struct {
+	rules   []robotsRule
+	expires time.Time
+}
+
+var (
+	// robotsCache is keyed by scheme://host.
+	robotsCache   = make(map[string]robotsRules)
+	robotsCacheMu sync.Mutex
+)
+
+// robotsEnabled reports whether ROBOTS_TXT asks for robots.txt checks.
+func robotsEnabled() bool {
+	v := os.Getenv("ROBOTS_TXT")
+	if v == "" {
+		return false
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		log.ErrorFmt("invalid ROBOTS_TXT %q, robots.txt checks disabled", v)
+	}
+	return on
+}
+
+// robotsAllowed reports whether robots.txt on u's host lets our User-Agent fetch u.
+// A robots.txt that cannot be fetched allows everything.
+func robotsAllowed(ctx context.Context, u *url.URL) bool {
+	origin := u.Scheme + "://" + u.Host
+	robotsCacheMu.Lock()
+	rules, ok := robotsCache[origin]
+	robotsCacheMu.Unlock()
+	if !ok || time.Now().After(rules.expires) {
+		rules = fetchRobots(ctx, origin)
+		robotsCacheMu.Lock()
+		robotsCache[origin] = rules
+		robotsCacheMu.Unlock()
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return rules.allowed(path)
+}
+
+func fetchRobots(ctx context.Context, origin string) robotsRules {
+	ctx, cancel := context.WithTimeout(ctx, feedTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, origin+"/robots.txt", nil)
+	if err != nil {
+		return robotsRules{expires: time.Now().Add(robotsRetry)}
+	}
+	req.Header.Set("User-Agent", feedUserAgent())
+	resp, err := sharedHTTPClient.Do(req)
+	if err != nil {
+		log.Info("robots.txt unavailable, allowing all", zap.String("origin", origin), zap.Error(err))
+		return robotsRules{expires: time.Now().Add(robotsRetry)}
+	}
+	// nolint:errcheck
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		// No robots.txt (4xx) means no restrictions; server errors are retried sooner.
+		ttl := robotsTTL
+		if resp.StatusCode >= 500 {
+			ttl = robotsRetry
+		}
+		return robotsRules{expires: time.Now().Add(ttl)}
+	}
+	rules := parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), feedUserAgent())
+	rules.expires = time.Now().Add(robotsTTL)
+	return rules
+}
+
+// parseRobots reads the groups of a robots.txt and keeps the rules for
+// userAgent's product token, falling back to the "*" group.
+func parseRobots(r io.Reader, userAgent string) robotsRules {
+	token, _, _ := strings.Cut(strings.ToLower(userAgent), "/")
+	token = strings.TrimSpace(token)
+
+	var own, wildcard []robotsRule
+	var agents []string
+	inRules := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+		switch key {
+		case "user-agent":
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, strings.ToLower(value))
+		case "allow", "disallow":
+			inRules = true
+			if value == "" {
+				continue
+			}
+			rule := robotsRule{allow: key == "allow", length: len(value), pattern: robotsPattern(value)}
+			for _, a := range agents {
+				switch a {
+				case token:
+					own = append(own, rule)
+				case "*":
+					wildcard = append(wildcard, rule)
+				}
+			}
+		}
+	}
+	if len(own) > 0 {
+		return robotsRules{rules: own}
+	}
+	return robotsRules{rules: wildcard}
+}
+
+// robotsPattern compiles a robots.txt path pattern, where "*" matches any
+// sequence and a trailing "$" anchors the end.
+func robotsPattern(p string) *regexp.Regexp {
+	anchored := strings.HasSuffix(p, "$")
+	p = strings.TrimSuffix(p, "$")
+	expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(p), `\*`, ".*")
+	if anchored {
+		expr += "$"
+	}
+	return regexp.MustCompile(expr)
+}
+
+// allowed applies the most specific matching rule; Allow wins a tie.
+func (r robotsRules) allowed(path string) bool {
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.length > best || (rule.length == best && rule.allow) {
+			best, allow = rule.length, rule.allow
+		}
+	}
+	return allow
+}
@@ -0,0 +1,321 @@
+package handlers
+
+import (
+	"context"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// schedulerResolution is how often the poller checks which feeds are due.
+const schedulerResolution = time.Second
+
+// feedSchedule tracks when a single feed was last fetched and when it is due again.
+type feedSchedule struct {
+	last time.Time
+	next time.Time
+	// configured is the feed's poll_interval or the default, used to spot config changes.
+	configured time.Duration
+	// interval is what the last fetch was scheduled with; adaptive polling may
+	// move it away from configured.
+	interval time.Duration
+	adaptive bool
+	hints    feedHints
+	hasHints bool
+	// backoff replaces interval while the feed keeps failing.
+	backoff time.Duration
+}
+
+var (
+	// schedule holds the polling schedule of every active feed, keyed by feed ID.
+	schedule   = make(map[string]*feedSchedule)
+	scheduleMu sync.Mutex
+	// cycleMu makes sure polling cycles never overlap, even across poller restarts.
+	cycleMu sync.Mutex
+	// runningSettings are the settings of the running poller, nil while it is
+	// stopped. It is guarded by pollerMu.
+	runningSettings *pollSettings
+)
+
+// defaultPollInterval is used for feeds without a poll_interval.
+// POLL_INTERVAL accepts a Go duration within the poll_interval bounds.
+func defaultPollInterval() time.Duration {
+	return envInterval("POLL_INTERVAL", 30*time.Second)
+}
+
+// pollJitter returns the largest random delay added to each fetch so feeds
+// sharing an interval are spread out. POLL_JITTER accepts a Go duration; "0" disables it.
+func pollJitter() time.Duration {
+	if v := os.Getenv("POLL_JITTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= 0 {
+			return d
+		}
+		log.ErrorFmt("invalid POLL_JITTER %q, using the default", v)
+	}
+	return 5 * time.Second
+}
+
+// pollSettings are the scheduler's environment settings. The poller reads
+// them once when it starts, so an invalid value is logged once instead of on
+// every tick.
+type pollSettings struct {
+	// interval is used for feeds without a poll_interval.
+	interval time.Duration
+	jitter   time.Duration
+	adaptive bool
+	// minInterval and maxInterval bound adaptive intervals.
+	minInterval, maxInterval time.Duration
+	backoffAfter             int
+	backoffMax               time.Duration
+	// quarantineAfter is 0 when feeds are never quarantined.
+	quarantineAfter  int
+	quarantineNotify bool
+}
+
+// pollSettingsFromEnv reads the scheduler settings from the environment.
+func pollSettingsFromEnv() pollSettings {
+	p := pollSettings{
+		interval:         defaultPollInterval(),
+		jitter:           pollJitter(),
+		adaptive:         adaptivePolling(),
+		backoffAfter:     feedBackoffAfter(),
+		backoffMax:       feedBackoffMax(),
+		quarantineAfter:  feedQuarantineAfter(),
+		quarantineNotify: quarantineNotify(),
+	}
+	p.minInterval, p.maxInterval = adaptiveBounds()
+	return p
+}
+
+// currentPollSettings returns the settings of the running poller, or the ones
+// it would start with while it is stopped.
+func currentPollSettings() pollSettings {
+	pollerMu.Lock()
+	p := runningSettings
+	pollerMu.Unlock()
+	if p != nil {
+		return *p
+	}
+	return pollSettingsFromEnv()
+}
+
+// jitter returns a random delay in [0, limit), never more than half of interval.
+func jitter(limit, interval time.Duration) time.Duration {
+	limit = min(limit, interval/2)
+	if limit <= 0 {
+		return 0
+	}
+	return rand.N(limit)
+}
+
+// feedInterval returns the interval s is polled at.
+func feedInterval(s Subscription, fallback time.Duration) time.Duration {
+	if d := time.Duration(s.PollInterval); d > 0 {
+		return d
+	}
+	return fallback
+}
+
+// dueFeeds returns the subscriptions that should be fetched at now. Feeds seen
+// for the first time are due after a random jitter; feeds that are no longer
+// configured are dropped from the schedule.
+func dueFeeds(now time.Time, subs []Subscription, p pollSettings) []Subscription {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	active := make(map[string]bool, len(subs))
+	var due []Subscription
+	for _, s := range subs {
+		active[s.ID] = true
+		interval := feedInterval(s, p.interval)
+		entry, ok := schedule[s.ID]
+		switch {
+		case !ok:
+			entry = &feedSchedule{next: now.Add(jitter(p.jitter, interval)), configured: interval, interval: interval}
+			schedule[s.ID] = entry
+		case entry.configured != interval:
+			// A changed poll_interval applies from the last fetch, not from the next one.
+			entry.configured, entry.interval, entry.adaptive = interval, interval, false
+			if !entry.last.IsZero() {
+				entry.next = entry.last.Add(interval)
+			}
+		}
+		if !now.Before(entry.next) {
+			due = append(due, s)
+		}
+	}
+	for id := range schedule {
+		if !active[id] {
+			delete(schedule, id)
+		}
+	}
+	return due
+}
+
+// resetSchedules forgets the schedule of subs, so they are fetched again
+// shortly, like newly added feeds.
+func resetSchedules(subs []Subscription) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	for _, s := range subs {
+		delete(schedule, s.ID)
+	}
+}
+
+// scheduleNext records that subs were fetched in the cycle that started at
+// start. feeds is index-aligned with subs; nil entries failed to fetch. With
+// adaptive polling, feeds without an explicit poll_interval are rescheduled
+// from their hints, keeping the hints of the last successful fetch.
+func scheduleNext(start time.Time, subs []Subscription, feeds []*gofeed.Feed, p pollSettings) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	for i, s := range subs {
+		entry, ok := schedule[s.ID]
+		if !ok {
+			continue
+		}
+		if i < len(feeds) && feeds[i] != nil {
+			entry.hints, entry.hasHints = hintsFromFeed(feeds[i]), true
+		}
+		entry.last = start
+		entry.interval, entry.adaptive = entry.configured, false
+		if p.adaptive && s.PollInterval == 0 && entry.hasHints {
+			entry.interval, entry.adaptive = adaptiveInterval(entry.configured, entry.hints, p.minInterval, p.maxInterval), true
+		}
+		entry.next = start.Add(entry.interval + jitter(p.jitter, entry.interval))
+		if entry.adaptive {
+			entry.next = entry.hints.skip(entry.next, start.Add(p.maxInterval))
+		}
+		entry.backoff = 0
+		if st, ok := lookupFeedStatus(s.URL); ok {
+			entry.backoff = p.failureBackoff(entry.interval, st.ConsecutiveFailures)
+		}
+		if entry.backoff > 0 {
+			entry.next = start.Add(entry.backoff + jitter(p.jitter, entry.backoff))
+		}
+	}
+}
+
+// pollDue runs one scheduler cycle, fetching only the feeds that are due at now
+// and not quarantined. Cycles are serialised, so a slow one delays the next
+// instead of overlapping it.
+func pollDue(now time.Time, p pollSettings) {
+	cycleMu.Lock()
+	defer cycleMu.Unlock()
+
+	snapshot := getConfigSnapshot()
+	active := snapshot.activeFeeds()
+	pruneConditionalCache(active)
+	pruneFeedStatuses(active)
+	// Disabled feeds keep their quarantine; only an admin may release it.
+	pruneQuarantine(context.Background(), snapshot.Feeds)
+	candidates := withoutQuarantined(active)
+	due := withSameURL(dueFeeds(now, candidates, p), candidates)
+	if len(due) == 0 {
+		return
+	}
+	log.Info("Poller: feeds due", zap.Int("feeds.due", len(due)), zap.Time("at", now))
+	feeds := pollAndNotify(due)
+	scheduleNext(now, due, feeds, p)
+	quarantineFailing(context.Background(), due, p)
+}
+
+// withSameURL adds the candidates sharing a URL with a due feed to due. The
+// URL is fetched for one of them anyway, so every subscriber gets the result.
+func withSameURL(due, candidates []Subscription) []Subscription {
+	urls := make(map[string]bool, len(due))
+	ids := make(map[string]bool, len(due))
+	for _, s := range due {
+		urls[s.URL], ids[s.ID] = true, true
+	}
+	for _, s := range candidates {
+		if urls[s.URL] && !ids[s.ID] {
+			due = append(due, s)
+		}
+	}
+	return due
+}
+
+// feedScheduleView is how a feed's schedule is reported by GET /feeds/schedule.
+type feedScheduleView struct {
+	ID       string         `json:"id"`
+	URL      string         `json:"url"`
+	Adaptive bool           `json:"adaptive"`
+	Interval Duration       `json:"interval"`
+	Backoff  Duration       `json:"backoff,omitempty"`
+	LastPoll *time.Time     `json:"last_poll,omitempty"`
+	NextPoll *time.Time     `json:"next_poll,omitempty"`
+	Hints    *feedHintsView `json:"hints,omitempty"`
+}
+
+type feedHintsView struct {
+	TTL          Duration `json:"ttl,omitempty"`
+	UpdatePeriod Duration `json:"update_period,omitempty"`
+	ItemGap      Duration `json:"item_gap,omitempty"`
+	SkipHours    []int    `json:"skip_hours,omitempty"`
+	SkipDays     []string `json:"skip_days,omitempty"`
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// scheduleSnapshot reports the schedule of every active feed of owner in config
+// order. Feeds the poller has not picked up yet show their configured interval only.
+func scheduleSnapshot(owner string, p pollSettings) []feedScheduleView {
+	subs := getConfigSnapshot().ownedBy(owner).activeFeeds()
+
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	views := make([]feedScheduleView, 0, len(subs))
+	for _, s := range subs {
+		view := feedScheduleView{ID: s.ID, URL: s.URL, Interval: Duration(feedInterval(s, p.interval))}
+		if entry, ok := schedule[s.ID]; ok {
+			view.Adaptive = entry.adaptive
+			view.Interval = Duration(entry.interval)
+			view.Backoff = Duration(entry.backoff)
+			view.LastPoll, view.NextPoll = timePtr(entry.last), timePtr(entry.next)
+			if entry.hasHints {
+				h := &feedHintsView{
+					TTL:          Duration(entry.hints.TTL),
+					UpdatePeriod: Duration(entry.hints.UpdatePeriod),
+					ItemGap:      Duration(entry.hints.ItemGap),
+					SkipHours:    entry.hints.SkipHours,
+				}
+				for _, d := range entry.hints.SkipDays {
+					h.SkipDays = append(h.SkipDays, d.String())
+				}
+				view.Hints = h
+			}
+		}
+		views = append(views, view)
+	}
+	return views
+}
+
+// FeedScheduleHandler reports when each feed was last polled, when it is due
+// next and the hints adaptive polling used (GET /feeds/schedule).
+func FeedScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.FeedScheduleHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /feeds/schedule established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	p := currentPollSettings()
+	views := scheduleSnapshot(userFrom(ctx), p)
+	span.SetAttributes(attribute.Int("feeds.count", len(views)))
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, http.StatusOK, map[string]any{"adaptive": p.adaptive, "feeds": views})
+}
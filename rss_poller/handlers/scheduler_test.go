@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// resetSchedule clears the polling schedule for a test.
+func resetSchedule(t *testing.T) {
+	t.Helper()
+	reset := func() {
+		scheduleMu.Lock()
+		schedule = make(map[string]*feedSchedule)
+		scheduleMu.Unlock()
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func ids(subs []Subscription) []string {
+	out := make([]string, len(subs))
+	for i, s := range subs {
+		out[i] = s.ID
+	}
+	return out
+}
+
+func TestDueFeeds(t *testing.T) {
+	resetSchedule(t)
+	t.Setenv("POLL_INTERVAL", "1m")
+	t.Setenv("POLL_JITTER", "0")
+	p := pollSettingsFromEnv()
+
+	subs := []Subscription{
+		{ID: "fast", URL: "https://fast.example/rss", PollInterval: Duration(30 * time.Second)},
+		{ID: "default", URL: "https://default.example/rss"},
+	}
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if got := dueFeeds(start, subs, p); len(got) != 2 {
+		t.Fatalf("expected new feeds to be due immediately, got %v", ids(got))
+	}
+	scheduleNext(start, subs, nil, p)
+
+	if got := dueFeeds(start.Add(10*time.Second), subs, p); len(got) != 0 {
+		t.Errorf("expected nothing due after 10s, got %v", ids(got))
+	}
+	if got := dueFeeds(start.Add(30*time.Second), subs, p); len(got) != 1 || got[0].ID != "fast" {
+		t.Errorf("expected only the fast feed after 30s, got %v", ids(got))
+	}
+	if got := dueFeeds(start.Add(time.Minute), subs, p); len(got) != 2 {
+		t.Errorf("expected both feeds after 1m, got %v", ids(got))
+	}
+
+	t.Run("IntervalChangeAppliesFromLastFetch", func(t *testing.T) {
+		changed := []Subscription{subs[0], subs[1]}
+		changed[1].PollInterval = Duration(45 * time.Second)
+		if got := dueFeeds(start.Add(45*time.Second), changed, p); len(got) != 2 {
+			t.Errorf("expected the shortened interval to make the feed due, got %v", ids(got))
+		}
+	})
+
+	t.Run("RemovedFeedsAreDropped", func(t *testing.T) {
+		dueFeeds(start, subs[:1], p)
+		scheduleMu.Lock()
+		_, ok := schedule["default"]
+		scheduleMu.Unlock()
+		if ok {
+			t.Error("expected the removed feed to leave the schedule")
+		}
+	})
+}
+
+func TestJitter(t *testing.T) {
+	for range 100 {
+		if d := jitter(10*time.Second, time.Minute); d < 0 || d >= 10*time.Second {
+			t.Fatalf("jitter out of range: %v", d)
+		}
+		if d := jitter(time.Minute, 10*time.Second); d >= 5*time.Second {
+			t.Fatalf("jitter must stay below half the interval, got %v", d)
+		}
+	}
+	if d := jitter(0, time.Minute); d != 0 {
+		t.Errorf("expected no jitter when disabled, got %v", d)
+	}
+}
+
+func TestPollDueDoesNotOverlap(t *testing.T) {
+	resetSchedule(t)
+	t.Setenv("POLL_JITTER", "0")
+	p := pollSettingsFromEnv()
+
+	var inFlight, maxInFlight atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		<-release
+		inFlight.Add(-1)
+		// nolint
+		w.Write([]byte(mockRSSFeedContent))
+	}))
+	defer server.Close()
+
+	resetConfig(t, ConfigStruct{Feeds: []Subscription{{ID: "slow", URL: server.URL}}})
+	t.Cleanup(func() {
+		feedMutex.Lock()
+		globalFeed = nil
+		feedCache = make(map[string]*gofeed.Feed)
+		feedMutex.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	now := time.Now()
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pollDue(now.Add(time.Duration(i)*time.Minute), p)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if got := maxInFlight.Load(); got != 1 {
+		t.Errorf("expected cycles to be serialised, saw %d concurrent fetches", got)
+	}
+}
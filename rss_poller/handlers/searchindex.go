@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"html"
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters, the usual defaults.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// titleBoost is how many times a title counts compared to the body.
+	titleBoost = 3
+)
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// tokenize lowercases text, drops HTML markup and splits it into words.
+func tokenize(text string) []string {
+	text = html.UnescapeString(htmlTag.ReplaceAllString(text, " "))
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// searchIndex is an inverted index over documents ranked with BM25.
+// It is not safe for concurrent use.
+type searchIndex struct {
+	// postings maps a term to the documents holding it and how often.
+	postings map[string]map[string]int
+	// docs keeps each document's term frequencies so it can be removed.
+	docs     map[string]map[string]int
+	docLen   map[string]int
+	totalLen int
+}
+
+func newSearchIndex() *searchIndex {
+	return &searchIndex{
+		postings: make(map[string]map[string]int),
+		docs:     make(map[string]map[string]int),
+		docLen:   make(map[string]int),
+	}
+}
+
+// add indexes a document, replacing an earlier version with the same id.
+func (s *searchIndex) add(id, title, body string) {
+	s.remove(id)
+	tf := make(map[string]int)
+	n := 0
+	for _, t := range tokenize(title) {
+		tf[t] += titleBoost
+		n += titleBoost
+	}
+	for _, t := range tokenize(body) {
+		tf[t]++
+		n++
+	}
+	for t, c := range tf {
+		p, ok := s.postings[t]
+		if !ok {
+			p = make(map[string]int)
+			s.postings[t] = p
+		}
+		p[id] = c
+	}
+	s.docs[id] = tf
+	s.docLen[id] = n
+	s.totalLen += n
+}
+
+func (s *searchIndex) remove(id string) {
+	tf, ok := s.docs[id]
+	if !ok {
+		return
+	}
+	for t := range tf {
+		delete(s.postings[t], id)
+		if len(s.postings[t]) == 0 {
+			delete(s.postings, t)
+		}
+	}
+	s.totalLen -= s.docLen[id]
+	delete(s.docs, id)
+	delete(s.docLen, id)
+}
+
+// search scores the documents holding any of the query's terms.
+func (s *searchIndex) search(query string) map[string]float64 {
+	scores := make(map[string]float64)
+	n := float64(len(s.docs))
+	if n == 0 {
+		return scores
+	}
+	avgLen := float64(s.totalLen) / n
+	seenTerms := make(map[string]bool)
+	for _, t := range tokenize(query) {
+		if seenTerms[t] {
+			continue
+		}
+		seenTerms[t] = true
+		p := s.postings[t]
+		df := float64(len(p))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, c := range p {
+			tf := float64(c)
+			norm := 1 - bm25B + bm25B*float64(s.docLen[id])/avgLen
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+	return scores
+}
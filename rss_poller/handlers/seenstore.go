@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// seenStore records the dedup keys of items that were already notified.
+//
+// Checking and updating is split in two so a crash between "marked seen" and
+// "sent" cannot lose items: Reserve claims the keys that are new, and once the
+// notification went out Commit records them durably. Release gives the keys
+// back when sending failed so the next cycle offers them again.
+type seenStore interface {
+	// Reserve returns the keys that are neither seen nor reserved, in order,
+	// and reserves them. Keys that were already seen count as used again.
+	Reserve(keys []string) ([]string, error)
+	// Commit marks reserved keys as seen.
+	Commit(keys []string) error
+	// Release drops reservations without marking the keys as seen.
+	Release(keys []string)
+	// Has reports whether key was seen or is reserved by a notification in flight.
+	Has(key string) bool
+	// Len returns the number of keys recorded as seen.
+	Len() int
+	// Fingerprint returns the content fingerprint recorded for a seen key.
+	Fingerprint(key string) (string, bool)
+	// SetFingerprints records the content fingerprints of seen keys. Keys that
+	// are not seen are ignored, so fingerprints are set after Commit.
+	SetFingerprints(fingerprints map[string]string) error
+	// Stats reports the store's size and how many keys it evicted so far.
+	Stats() seenStats
+	Close() error
+}
+
+// seenStats is reported on the polling spans.
+type seenStats struct {
+	Size    int
+	Pending int
+	Evicted uint64
+}
+
+// seen is the active store. It starts in memory; OpenSeenStore swaps in the on-disk one.
+var seen seenStore = newMemorySeenStore(seenMaxEntries(), seenTTL())
+
+// seenMaxEntries caps the number of seen keys. SEEN_MAX_ENTRIES accepts a positive integer.
+func seenMaxEntries() int {
+	if v := os.Getenv("SEEN_MAX_ENTRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err == nil && n > 0 {
+			return n
+		}
+		log.ErrorFmt("invalid SEEN_MAX_ENTRIES %q, using the default", v)
+	}
+	return 100000
+}
+
+// seenTTL is how long a key is kept after it was last found in a feed.
+// SEEN_TTL accepts a Go duration of at least the longest poll interval, so
+// items of a rarely polled feed are not forgotten between two polls.
+func seenTTL() time.Duration {
+	if v := os.Getenv("SEEN_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err == nil && d >= maxPollInterval {
+			return d
+		}
+		log.ErrorFmt("invalid SEEN_TTL %q, using the default", v)
+	}
+	return 30 * 24 * time.Hour
+}
+
+// seenEntry is a seen key and when it was last found in a feed.
+type seenEntry struct {
+	key     string
+	touched time.Time
+	// fingerprint identifies the item's content when it was last notified or found.
+	fingerprint string
+}
+
+// memorySeenStore keeps the seen keys in memory only. It is what tests use and
+// what the poller falls back to when the on-disk store cannot be opened.
+//
+// Keys are kept in least-recently-used order. Every poll touches the keys of
+// the items still in a feed, so eviction by age or by count only drops items
+// that left their feed, as long as maxEntries exceeds the items currently
+// served by all feeds.
+type memorySeenStore struct {
+	mu         sync.Mutex
+	lru        *list.List // of *seenEntry, most recently touched first
+	keys       map[string]*list.Element
+	pending    map[string]bool
+	maxEntries int
+	ttl        time.Duration
+	evicted    uint64
+	now        func() time.Time
+}
+
+func newMemorySeenStore(maxEntries int, ttl time.Duration) *memorySeenStore {
+	return &memorySeenStore{
+		lru:        list.New(),
+		keys:       make(map[string]*list.Element),
+		pending:    make(map[string]bool),
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		now:        time.Now,
+	}
+}
+
+func (m *memorySeenStore) Reserve(keys []string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var fresh []string
+	for _, k := range keys {
+		if k == "" || m.pending[k] {
+			continue
+		}
+		if el, ok := m.keys[k]; ok {
+			el.Value.(*seenEntry).touched = now
+			m.lru.MoveToFront(el)
+			continue
+		}
+		m.pending[k] = true
+		fresh = append(fresh, k)
+	}
+	m.evictLocked(now)
+	return fresh, nil
+}
+
+func (m *memorySeenStore) Commit(keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commitLocked(keys)
+	return nil
+}
+
+func (m *memorySeenStore) commitLocked(keys []string) {
+	now := m.now()
+	for _, k := range keys {
+		delete(m.pending, k)
+		if el, ok := m.keys[k]; ok {
+			el.Value.(*seenEntry).touched = now
+			m.lru.MoveToFront(el)
+			continue
+		}
+		m.keys[k] = m.lru.PushFront(&seenEntry{key: k, touched: now})
+	}
+	m.evictLocked(now)
+}
+
+// evictLocked drops keys that were not found in a feed for longer than ttl,
+// then the least recently used ones beyond maxEntries.
+func (m *memorySeenStore) evictLocked(now time.Time) {
+	for el := m.lru.Back(); el != nil; el = m.lru.Back() {
+		e := el.Value.(*seenEntry)
+		if m.lru.Len() <= m.maxEntries && now.Sub(e.touched) <= m.ttl {
+			return
+		}
+		m.lru.Remove(el)
+		delete(m.keys, e.key)
+		m.evicted++
+	}
+}
+
+func (m *memorySeenStore) Fingerprint(key string) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if el, ok := m.keys[key]; ok {
+		fp := el.Value.(*seenEntry).fingerprint
+		return fp, fp != ""
+	}
+	return "", false
+}
+
+func (m *memorySeenStore) SetFingerprints(fingerprints map[string]string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setFingerprintsLocked(fingerprints)
+	return nil
+}
+
+// setFingerprintsLocked records fingerprints without touching the keys, as
+// they are only set for keys that a poll already touched.
+func (m *memorySeenStore) setFingerprintsLocked(fingerprints map[string]string) {
+	for k, fp := range fingerprints {
+		if el, ok := m.keys[k]; ok {
+			el.Value.(*seenEntry).fingerprint = fp
+		}
+	}
+}
+
+func (m *memorySeenStore) Release(keys []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, k := range keys {
+		delete(m.pending, k)
+	}
+}
+
+func (m *memorySeenStore) Has(key string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.keys[key]
+	return ok || m.pending[key]
+}
+
+func (m *memorySeenStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.keys)
+}
+
+func (m *memorySeenStore) Stats() seenStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return seenStats{Size: len(m.keys), Pending: len(m.pending), Evicted: m.evicted}
+}
+
+// orderedKeys returns the seen keys, least recently used first.
+func (m *memorySeenStore) orderedKeys() []string {
+	keys := make([]string, 0, m.lru.Len())
+	for el := m.lru.Back(); el != nil; el = el.Prev() {
+		keys = append(keys, el.Value.(*seenEntry).key)
+	}
+	return keys
+}
+
+// fingerprints returns the recorded fingerprints of the seen keys.
+func (m *memorySeenStore) fingerprints() map[string]string {
+	fps := make(map[string]string)
+	for el := m.lru.Front(); el != nil; el = el.Next() {
+		if e := el.Value.(*seenEntry); e.fingerprint != "" {
+			fps[e.key] = e.fingerprint
+		}
+	}
+	return fps
+}
+
+func (m *memorySeenStore) Close() error { return nil }
+
+// diskSeenStore is a memorySeenStore backed by an append-only log. Every
+// Commit is written as one JSON array per line and fsynced before the keys
+// count as seen, so a commit is either fully on disk or, if the process died
+// mid-write, discarded as a torn last line when the log is reopened.
+// Fingerprints are written the same way as one JSON object per line.
+//
+// Evicted keys and superseded fingerprints stay in the log until it holds
+// more than four entries per live key; it is then rewritten with the live
+// keys and their fingerprints only. Reopening the log restores
+// the LRU order but not the ages, which restart from the time of loading.
+type diskSeenStore struct {
+	*memorySeenStore
+	path string
+	file *os.File
+	// logged is the number of keys and fingerprints in the log, evicted ones included.
+	logged int
+}
+
+// seenCompactChunk is how many keys a compacted log holds per line.
+const seenCompactChunk = 1000
+
+// openDiskSeenStore opens (or creates) the log at path and loads the keys in it.
+func openDiskSeenStore(path string, maxEntries int, ttl time.Duration) (*diskSeenStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	mem := newMemorySeenStore(maxEntries, ttl)
+	valid, logged, err := loadSeenLog(f, mem)
+	if err == nil {
+		// Drop a torn last line so new commits start on a clean line.
+		err = f.Truncate(valid)
+	}
+	if err == nil {
+		_, err = f.Seek(valid, io.SeekStart)
+	}
+	if err != nil {
+		// nolint:errcheck
+		f.Close()
+		return nil, err
+	}
+	return &diskSeenStore{memorySeenStore: mem, path: path, file: f, logged: logged}, nil
+}
+
+// loadSeenLog reads every complete line in r into mem and returns the length
+// of the valid prefix of the log and the number of entries in it.
+func loadSeenLog(r io.Reader, mem *memorySeenStore) (int64, int, error) {
+	var valid int64
+	var logged int
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return valid, logged, nil
+		}
+		if err != nil {
+			return valid, logged, err
+		}
+		entry := bytes.TrimSpace(line)
+		var jerr error
+		if bytes.HasPrefix(entry, []byte("{")) {
+			var fps map[string]string
+			if jerr = json.Unmarshal(entry, &fps); jerr == nil {
+				mem.setFingerprintsLocked(fps)
+				logged += len(fps)
+			}
+		} else {
+			var keys []string
+			if jerr = json.Unmarshal(entry, &keys); jerr == nil {
+				mem.commitLocked(keys)
+				logged += len(keys)
+			}
+		}
+		if jerr != nil {
+			log.ErrorFmt("seen store: ignoring the log from a corrupt entry onwards: %v", jerr)
+			return valid, logged, nil
+		}
+		valid += int64(len(line))
+	}
+}
+
+func (d *diskSeenStore) Commit(keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(keys)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// The keys count as seen even if the write fails: the notification has
+	// already gone out and re-sending it every cycle would be worse.
+	d.commitLocked(keys)
+	return d.appendLocked(line, len(keys))
+}
+
+func (d *diskSeenStore) SetFingerprints(fingerprints map[string]string) error {
+	if len(fingerprints) == 0 {
+		return nil
+	}
+	line, err := json.Marshal(fingerprints)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.setFingerprintsLocked(fingerprints)
+	return d.appendLocked(line, len(fingerprints))
+}
+
+// appendLocked writes and fsyncs a log line holding n entries, compacting the
+// log once it is mostly evicted or superseded entries.
+func (d *diskSeenStore) appendLocked(line []byte, n int) error {
+	if _, err := d.file.Write(line); err != nil {
+		return err
+	}
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	d.logged += n
+	if d.logged > 4*len(d.keys)+seenCompactChunk {
+		return d.compactLocked()
+	}
+	return nil
+}
+
+// compactLocked rewrites the log with the live keys only, oldest first,
+// followed by their fingerprints.
+func (d *diskSeenStore) compactLocked() error {
+	keys := d.orderedKeys()
+	fps := d.fingerprints()
+	var buf bytes.Buffer
+	for start := 0; start < len(keys); start += seenCompactChunk {
+		chunk := keys[start:min(start+seenCompactChunk, len(keys))]
+		line, err := json.Marshal(chunk)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		chunkFPs := make(map[string]string)
+		for _, k := range chunk {
+			if fp, ok := fps[k]; ok {
+				chunkFPs[k] = fp
+			}
+		}
+		if len(chunkFPs) == 0 {
+			continue
+		}
+		if line, err = json.Marshal(chunkFPs); err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := writeFileAtomic(d.path, buf.Bytes(), 0o644); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(d.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	// nolint:errcheck
+	d.file.Close()
+	d.file = f
+	d.logged = len(keys) + len(fps)
+	return nil
+}
+
+func (d *diskSeenStore) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.file.Close()
+}
+
+// seenStorePath returns where the seen log lives. SEEN_STORE overrides the
+// default; "memory" keeps the keys in memory only.
+func seenStorePath() string {
+	if p := os.Getenv("SEEN_STORE"); p != "" {
+		return p
+	}
+	return "/var/lib/rss-poller/seen.log"
+}
+
+// OpenSeenStore replaces the in-memory seen store with the on-disk one so
+// items are not notified again after a restart. If the log cannot be opened
+// the poller keeps working with the in-memory store.
+func OpenSeenStore(ctx context.Context) {
+	_, span := startSpan(ctx, "bootstrap.OpenSeenStore", trace.SpanKindInternal)
+	defer span.End()
+
+	path := seenStorePath()
+	span.SetAttributes(attribute.String("seen.path", path))
+	if path == "memory" {
+		log.Info("seen store kept in memory, items will be notified again after a restart")
+		return
+	}
+	store, err := openDiskSeenStore(path, seenMaxEntries(), seenTTL())
+	if err != nil {
+		spanErrorf(span, err, "failed to open seen store %s, keeping it in memory: %v", path, err)
+		return
+	}
+	span.SetAttributes(attribute.Int("seen.keys", store.Len()))
+	log.Info("loaded seen items", zap.Int("seen.keys", store.Len()), zap.String("seen.path", path))
+	// nolint:errcheck
+	seen.Close()
+	seen = store
+}
+
+// commitSeen records keys as seen along with the fingerprints of the items
+// that were delivered, logging rather than failing on a write error.
+func commitSeen(span trace.Span, keys []string, fingerprints map[string]string) {
+	if err := seen.Commit(keys); err != nil {
+		spanErrorf(span, err, "failed to persist seen items: %v", err)
+	}
+	if err := seen.SetFingerprints(fingerprints); err != nil {
+		spanErrorf(span, err, "failed to persist item fingerprints: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemorySeenStoreReservations(t *testing.T) {
+	s := newMemorySeenStore(10, time.Hour)
+	fresh, err := s.Reserve([]string{"a", "b", "a", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fresh, []string{"a", "b"}) {
+		t.Fatalf("unexpected reservation %v", fresh)
+	}
+	if again, _ := s.Reserve([]string{"a", "b", "c"}); !reflect.DeepEqual(again, []string{"c"}) {
+		t.Errorf("reserved keys must not be handed out twice, got %v", again)
+	}
+
+	s.Release([]string{"b"})
+	if err := s.Commit([]string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	if s.Has("b") || !s.Has("a") || s.Len() != 1 {
+		t.Errorf("unexpected state: has(a)=%v has(b)=%v len=%d", s.Has("a"), s.Has("b"), s.Len())
+	}
+	if retry, _ := s.Reserve([]string{"a", "b"}); !reflect.DeepEqual(retry, []string{"b"}) {
+		t.Errorf("a released key must be offered again, got %v", retry)
+	}
+}
+
+func TestDiskSeenStoreSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "seen.log")
+	store, err := openDiskSeenStore(path, 100, maxPollInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := store.Reserve([]string{"one", "two", "three"})
+	if err := store.Commit(keys[:2]); err != nil {
+		t.Fatal(err)
+	}
+	// "three" was reserved but never sent: it must be offered again after a restart.
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := openDiskSeenStore(path, 100, maxPollInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if fresh, _ := reopened.Reserve([]string{"one", "two", "three"}); !reflect.DeepEqual(fresh, []string{"three"}) {
+		t.Errorf("expected only the unsent key to be new after a restart, got %v", fresh)
+	}
+}
+
+func TestDiskSeenStoreDropsTornCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.log")
+	// The second commit was cut short by a crash.
+	if err := os.WriteFile(path, []byte("[\"a\",\"b\"]\n[\"c\",\"d"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	store, err := openDiskSeenStore(path, 100, maxPollInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 2 || store.Has("c") {
+		t.Fatalf("expected only the complete commit to load, len=%d", store.Len())
+	}
+	if err := store.Commit([]string{"e"}); err != nil {
+		t.Fatal(err)
+	}
+	// nolint:errcheck
+	store.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "[\"a\",\"b\"]\n[\"e\"]\n" {
+		t.Errorf("unexpected log after recovery: %q", data)
+	}
+}
+
+func TestMemorySeenStoreEviction(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newMemorySeenStore(3, 24*time.Hour)
+	s.now = func() time.Time { return now }
+	commit := func(keys ...string) {
+		t.Helper()
+		fresh, _ := s.Reserve(keys)
+		if err := s.Commit(fresh); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	commit("a", "b", "c")
+	// "a" is still in its feed, so this poll touches it.
+	now = now.Add(time.Hour)
+	commit("a", "d")
+	if s.Has("b") || !s.Has("a") || s.Len() != 3 {
+		t.Errorf("expected the least recently used key to go, got %v", s.orderedKeys())
+	}
+
+	now = now.Add(24*time.Hour + time.Minute)
+	commit("d")
+	if s.Has("c") || s.Has("a") || !s.Has("d") {
+		t.Errorf("expected keys untouched for a day to expire, got %v", s.orderedKeys())
+	}
+	if stats := s.Stats(); stats.Evicted != 3 || stats.Size != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestDiskSeenStoreCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.log")
+	store, err := openDiskSeenStore(path, 10, maxPollInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*seenCompactChunk; i++ {
+		key := filepath.Join("item", string(rune('a'+i%26)), time.Duration(i).String())
+		fresh, _ := store.Reserve([]string{key})
+		if err := store.Commit(fresh); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if store.logged > 2*store.Len()+seenCompactChunk {
+		t.Errorf("expected the log to be compacted, it holds %d keys for %d live ones", store.logged, store.Len())
+	}
+	live := store.orderedKeys()
+	// nolint:errcheck
+	store.Close()
+
+	reopened, err := openDiskSeenStore(path, 10, maxPollInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got := reopened.orderedKeys(); !reflect.DeepEqual(got, live) {
+		t.Errorf("reopened store differs: got %v, want %v", got, live)
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Event types of GET /rss/stream.
+const (
+	streamEventItem    = "item"
+	streamEventUpdated = "updated"
+)
+
+// streamHeartbeat is how often an idle stream sends a comment so proxies keep it open.
+const streamHeartbeat = 15 * time.Second
+
+// streamSubscriberBuffer is how many events a client may lag behind before it
+// is disconnected; it resumes from the replay buffer when it reconnects.
+const streamSubscriberBuffer = 64
+
+// streamEvent is an item pushed to GET /rss/stream.
+type streamEvent struct {
+	ID     uint64
+	Type   string
+	FeedID string
+	// Owner is the user owning the feed, "" without users.
+	Owner string
+	// Tags are the tags of the feed when the event was published.
+	Tags []string
+	// Data is the item encoded as in GET /rss.
+	Data []byte
+}
+
+type streamSubscriber struct {
+	owner string
+	// feeds restricts the subscription to these feed IDs; nil allows every feed.
+	feeds map[string]bool
+	// tag restricts the subscription to feeds carrying it, checked against
+	// each event so feeds tagged after the client connected are included.
+	tag    string
+	events chan streamEvent
+}
+
+func (s *streamSubscriber) wants(e streamEvent) bool {
+	return e.Owner == s.owner && (s.feeds == nil || s.feeds[e.FeedID]) &&
+		(s.tag == "" || slices.ContainsFunc(e.Tags, func(t string) bool { return strings.EqualFold(t, s.tag) }))
+}
+
+// streamBroker fans new items out to the connected clients and keeps the
+// latest events so reconnecting clients can resume where they left off.
+type streamBroker struct {
+	mu     sync.Mutex
+	lastID uint64
+	// replay holds the latest events, oldest first.
+	replay []streamEvent
+	size   int
+	subs   map[*streamSubscriber]struct{}
+}
+
+func newStreamBroker(size int) *streamBroker {
+	return &streamBroker{size: size, subs: make(map[*streamSubscriber]struct{})}
+}
+
+// stream is the broker behind GET /rss/stream.
+var stream = newStreamBroker(streamReplaySize())
+
+// streamReplaySize is how many events are kept for resuming clients.
+// STREAM_REPLAY accepts a positive integer.
+func streamReplaySize() int {
+	return envCount("STREAM_REPLAY", 1000, 1)
+}
+
+// publish numbers events and hands them to the matching subscribers. A
+// subscriber that cannot keep up is disconnected rather than slowing the poller.
+func (b *streamBroker) publish(events []streamEvent) {
+	if len(events) == 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, e := range events {
+		b.lastID++
+		e.ID = b.lastID
+		b.replay = append(b.replay, e)
+		for s := range b.subs {
+			if !s.wants(e) {
+				continue
+			}
+			select {
+			case s.events <- e:
+			default:
+				delete(b.subs, s)
+				close(s.events)
+			}
+		}
+	}
+	if n := len(b.replay) - b.size; n > 0 {
+		b.replay = append(b.replay[:0:0], b.replay[n:]...)
+	}
+}
+
+// subscribe registers a client of owner, interested in feeds and tag, and
+// returns the buffered events it missed after lastEventID. Without a lastEventID nothing is replayed; an ID this
+// process never handed out, left over from before a restart, replays the
+// whole buffer.
+func (b *streamBroker) subscribe(owner string, feeds map[string]bool, tag string, lastEventID *uint64) ([]streamEvent, *streamSubscriber) {
+	s := &streamSubscriber{owner: owner, feeds: feeds, tag: tag, events: make(chan streamEvent, streamSubscriberBuffer)}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var missed []streamEvent
+	if lastEventID != nil {
+		after := *lastEventID
+		if after > b.lastID {
+			after = 0
+		}
+		for _, e := range b.replay {
+			if e.ID > after && s.wants(e) {
+				missed = append(missed, e)
+			}
+		}
+	}
+	b.subs[s] = struct{}{}
+	return missed, s
+}
+
+func (b *streamBroker) unsubscribe(s *streamSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.events)
+	}
+}
+
+// publishItems streams the items of one polling cycle. feeds is index-aligned
+// with subs, with baselined feeds already removed; fresh and updated are the
+// seen-store keys of the new and changed items. Items past ITEM_MAX_AGE are
+// left out, as they are from notifications.
+func publishItems(subs []Subscription, feeds []*gofeed.Feed, fresh []string, updated map[string]string) {
+	if len(fresh)+len(updated) == 0 {
+		return
+	}
+	isFresh := make(map[string]bool, len(fresh))
+	for _, k := range fresh {
+		isFresh[k] = true
+	}
+	cutoff := notifyCutoff()
+	done := make(map[string]bool)
+	var events []streamEvent
+	for i, f := range feeds {
+		if f == nil || i >= len(subs) {
+			continue
+		}
+		source := newFeedSource(subs[i], f)
+		for _, it := range f.Items {
+			k := seenKey(subs[i].Owner, it)
+			if done[k] || tooOld(it, cutoff) {
+				continue
+			}
+			typ := streamEventItem
+			if _, ok := updated[k]; ok {
+				typ = streamEventUpdated
+			} else if !isFresh[k] {
+				continue
+			}
+			done[k] = true
+			item := newFeedsJSON(it)
+			item.Source = &source
+			data, err := json.Marshal(item)
+			if err != nil {
+				log.ErrorFmt("failed to encode stream event: %v", err)
+				continue
+			}
+			events = append(events, streamEvent{Type: typ, FeedID: subs[i].ID, Owner: subs[i].Owner, Tags: subs[i].Tags, Data: data})
+		}
+	}
+	stream.publish(events)
+}
+
+// writeStreamEvent writes e in the text/event-stream format.
+func writeStreamEvent(w http.ResponseWriter, e streamEvent) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+	return err
+}
+
+// RSSStreamHandler pushes new and updated items as Server-Sent Events
+// (GET /rss/stream). Clients filter with the feed and tag parameters of
+// GET /rss and resume with the Last-Event-ID header or the last_event_id
+// parameter, for clients that cannot set headers.
+func RSSStreamHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "handlers.RSSStreamHandler", trace.SpanKindServer)
+	defer span.End()
+	log.Info("connection to GET /rss/stream established", zap.String("trace_id", span.SpanContext().TraceID().String()))
+
+	feeds, tag := feedParams(r.URL.Query()), r.URL.Query().Get("tag")
+	var lastEventID *uint64
+	last := r.Header.Get("Last-Event-ID")
+	if last == "" {
+		last = r.URL.Query().Get("last_event_id")
+	}
+	if last != "" {
+		id, err := strconv.ParseUint(last, 10, 64)
+		if err != nil {
+			msg := "last event ID must be a non-negative integer"
+			httpSpanError(span, r.Method, msg, http.StatusBadRequest)
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": msg})
+			return
+		}
+		lastEventID = &id
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		spanErrorf(span, err, "streaming not supported: %v", err)
+		return
+	}
+	recordHTTPSpan(span, r.Method, http.StatusOK)
+
+	missed, sub := stream.subscribe(userFrom(ctx), feeds, tag, lastEventID)
+	defer stream.unsubscribe(sub)
+	sent := 0
+	defer func() { span.SetAttributes(attribute.Int("stream.events", sent)) }()
+	for _, e := range missed {
+		if err := writeStreamEvent(w, e); err != nil {
+			return
+		}
+		sent++
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.events:
+			if !ok {
+				log.Info("stream client fell behind, disconnecting", zap.String("trace_id", span.SpanContext().TraceID().String()))
+				return
+			}
+			if err := writeStreamEvent(w, e); err != nil {
+				return
+			}
+			sent++
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestStreamBrokerResume(t *testing.T) {
+	b := newStreamBroker(3)
+	b.publish([]streamEvent{{FeedID: "a"}, {FeedID: "b"}, {FeedID: "a"}, {FeedID: "b"}})
+
+	eventIDs := func(events []streamEvent) []uint64 {
+		var out []uint64
+		for _, e := range events {
+			out = append(out, e.ID)
+		}
+		return out
+	}
+	after := func(id uint64) *uint64 { return &id }
+
+	if missed, _ := b.subscribe("", nil, "", nil); len(missed) != 0 {
+		t.Errorf("expected a client without a last event ID to get no replay, got %v", eventIDs(missed))
+	}
+	if missed, _ := b.subscribe("", nil, "", after(2)); !equalIDs(eventIDs(missed), 3, 4) {
+		t.Errorf("expected events 3 and 4 after 2, got %v", eventIDs(missed))
+	}
+	if missed, _ := b.subscribe("", map[string]bool{"a": true}, "", after(0)); !equalIDs(eventIDs(missed), 3) {
+		t.Errorf("expected the replay to be filtered and trimmed to the buffer, got %v", eventIDs(missed))
+	}
+	if missed, _ := b.subscribe("", nil, "", after(99)); !equalIDs(eventIDs(missed), 2, 3, 4) {
+		t.Errorf("expected an unknown ID to replay the whole buffer, got %v", eventIDs(missed))
+	}
+
+	_, slow := b.subscribe("", nil, "", nil)
+	for range streamSubscriberBuffer + 1 {
+		b.publish([]streamEvent{{FeedID: "a"}})
+	}
+	n := 0
+	for range slow.events {
+		n++
+	}
+	if n != streamSubscriberBuffer {
+		t.Errorf("expected a lagging client to be disconnected after %d events, got %d", streamSubscriberBuffer, n)
+	}
+}
+
+func TestStreamBrokerTagFilter(t *testing.T) {
+	b := newStreamBroker(10)
+	// The client connects before any feed carries the tag.
+	_, sub := b.subscribe("", nil, "news", nil)
+	b.publish([]streamEvent{{FeedID: "a"}, {FeedID: "a", Tags: []string{"News"}}, {FeedID: "b", Tags: []string{"blog"}}})
+	b.unsubscribe(sub)
+	var got []string
+	for e := range sub.events {
+		got = append(got, fmt.Sprintf("%d:%s", e.ID, e.FeedID))
+	}
+	if len(got) != 1 || got[0] != "2:a" {
+		t.Errorf("expected only the event of the newly tagged feed, got %v", got)
+	}
+	if missed, _ := b.subscribe("", nil, "NEWS", new(uint64)); len(missed) != 1 || missed[0].ID != 2 {
+		t.Errorf("expected the replay to be filtered by tag, got %+v", missed)
+	}
+}
+
+func equalIDs(got []uint64, want ...uint64) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRSSStreamHandler(t *testing.T) {
+	t.Setenv("FEED_BASELINE", "false")
+	seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+	stream = newStreamBroker(streamReplaySize())
+	t.Cleanup(func() {
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+		stream = newStreamBroker(streamReplaySize())
+	})
+	mockServer := startMockRSSFeedServer()
+	defer mockServer.Close()
+	subs := []Subscription{
+		{ID: "mock", URL: mockServer.URL, Tags: []string{"test"}},
+		{ID: "other", URL: "http://other.example/feed"},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+
+	server := httptest.NewServer(http.HandlerFunc(RSSStreamHandler))
+	defer server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	type event struct {
+		id, typ string
+		item    feedsJSON
+	}
+	connect := func(query string, lastEventID string) (*bufio.Scanner, func()) {
+		t.Helper()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatalf("unexpected Content-Type %q", ct)
+		}
+		// nolint:errcheck
+		return bufio.NewScanner(resp.Body), func() { resp.Body.Close() }
+	}
+	next := func(sc *bufio.Scanner) event {
+		t.Helper()
+		var e event
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "" && e.id != "":
+				return e
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.item); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		t.Fatalf("stream ended: %v", sc.Err())
+		return e
+	}
+
+	live, closeLive := connect("tag=test", "")
+	defer closeLive()
+	// Wait for the subscription to be registered before polling.
+	for {
+		stream.mu.Lock()
+		n := len(stream.subs)
+		stream.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	pollAndNotify(subs)
+
+	first := next(live)
+	if first.typ != streamEventItem || first.item.Link != "http://example.com/item1" || first.item.Source == nil || first.item.Source.ID != "mock" {
+		t.Errorf("unexpected first event %+v", first)
+	}
+	if second := next(live); second.item.Link != "http://example.com/item2" {
+		t.Errorf("unexpected second event %+v", second)
+	}
+
+	// A reconnecting client resumes after the last event it saw.
+	resumed, closeResumed := connect("", first.id)
+	defer closeResumed()
+	if e := next(resumed); e.item.Link != "http://example.com/item2" {
+		t.Errorf("expected the resumed stream to start with item2, got %+v", e)
+	}
+
+	// Items already seen are not streamed again.
+	pollAndNotify(subs)
+	publishItems(subs, []*gofeed.Feed{nil, {Items: []*gofeed.Item{{GUID: "o1", Link: "http://other.example/1"}}}}, []string{"o1"}, nil)
+	if e := next(resumed); e.item.Link != "http://other.example/1" {
+		t.Errorf("expected only the new item of the other feed, got %+v", e)
+	}
+
+	rr := httptest.NewRecorder()
+	RSSStreamHandler(rr, httptest.NewRequest(http.MethodGet, "/rss/stream?last_event_id=abc", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid last event ID, got %d", rr.Code)
+	}
+}
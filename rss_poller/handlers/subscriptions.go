@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Subscription is a single feed the poller tracks together with its per-feed settings.
+type Subscription struct {
+	// ID is stable for the lifetime of the subscription. When omitted it is derived from URL.
+	ID   string   `json:"id"`
+	URL  string   `json:"url"`
+	Name string   `json:"name,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+	// Disabled subscriptions are kept in the config but never fetched.
+	Disabled bool `json:"disabled,omitempty"`
+	// PollInterval overrides the global polling interval for this feed.
+	PollInterval Duration `json:"poll_interval,omitempty"`
+	// WebhookURL overrides NOTIFICATION_ENDPOINT for items coming from this feed.
+	WebhookURL string `json:"webhook_url,omitempty"`
+	// Owner is the user the subscription belongs to; it is set from the
+	// caller's API token and empty while no users are configured.
+	Owner string `json:"owner,omitempty"`
+}
+
+// Duration is a time.Duration that is encoded in JSON as a Go duration string ("5m", "1h30m").
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Plain numbers are read as seconds.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	switch v := raw.(type) {
+	case float64:
+		*d = Duration(time.Duration(v * float64(time.Second)))
+	case string:
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", v, err)
+		}
+		*d = Duration(parsed)
+	case nil:
+		*d = 0
+	default:
+		return fmt.Errorf("invalid duration %s", string(data))
+	}
+	return nil
+}
+
+// feedID derives a stable identifier from a feed URL so legacy configs
+// migrate to the same IDs on every start.
+func feedID(feedURL string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(feedURL)))
+	return hex.EncodeToString(sum[:6])
+}
+
+// defaultID is the ID s gets when none is given. Feed IDs are unique across
+// users, so two users subscribing to the same URL get different IDs.
+func (s Subscription) defaultID() string {
+	if s.Owner == "" {
+		return feedID(s.URL)
+	}
+	return feedID(s.Owner + " " + s.URL)
+}
+
+// UnmarshalJSON accepts both the subscription format ({"feeds": [...]}) and the
+// legacy bare URL list ({"rss_feeds": [...]}). Legacy URLs are migrated into
+// subscriptions unless a subscription with the same URL is already present.
+func (c *ConfigStruct) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Revision uint64         `json:"revision"`
+		Feeds    []Subscription `json:"feeds"`
+		RSSFeeds []string       `json:"rss_feeds"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	next := ConfigStruct{Revision: raw.Revision, Feeds: raw.Feeds}
+	for _, u := range raw.RSSFeeds {
+		if next.indexByURL(u) >= 0 {
+			continue
+		}
+		next.Feeds = append(next.Feeds, Subscription{URL: u})
+	}
+	next.normalize()
+	*c = next
+	return nil
+}
+
+// normalize trims URLs and fills in missing IDs.
+func (c *ConfigStruct) normalize() {
+	for i := range c.Feeds {
+		c.Feeds[i].URL = strings.TrimSpace(c.Feeds[i].URL)
+		if c.Feeds[i].ID == "" {
+			c.Feeds[i].ID = c.Feeds[i].defaultID()
+		}
+	}
+}
+
+// clone returns a deep copy so callers can modify the result without touching cfg.
+func (c ConfigStruct) clone() ConfigStruct {
+	out := c
+	out.Feeds = make([]Subscription, len(c.Feeds))
+	for i, s := range c.Feeds {
+		s.Tags = slices.Clone(s.Tags)
+		out.Feeds[i] = s
+	}
+	return out
+}
+
+// indexByURL returns the position of the subscription for feedURL, or -1.
+func (c ConfigStruct) indexByURL(feedURL string) int {
+	feedURL = strings.TrimSpace(feedURL)
+	return slices.IndexFunc(c.Feeds, func(s Subscription) bool { return s.URL == feedURL })
+}
+
+// indexByID returns the position of the subscription with the given ID, or -1.
+func (c ConfigStruct) indexByID(id string) int {
+	return slices.IndexFunc(c.Feeds, func(s Subscription) bool { return s.ID == id })
+}
+
+// ownedBy returns the config as seen by owner: the same revision with only
+// the subscriptions owner owns.
+func (c ConfigStruct) ownedBy(owner string) ConfigStruct {
+	out := ConfigStruct{Revision: c.Revision, Feeds: []Subscription{}}
+	for _, s := range c.Feeds {
+		if s.Owner == owner {
+			s.Tags = slices.Clone(s.Tags)
+			out.Feeds = append(out.Feeds, s)
+		}
+	}
+	return out
+}
+
+// feedIDs returns the IDs of every subscription.
+func (c ConfigStruct) feedIDs() map[string]bool {
+	ids := make(map[string]bool, len(c.Feeds))
+	for _, s := range c.Feeds {
+		ids[s.ID] = true
+	}
+	return ids
+}
+
+// feedIDsWithTag returns the IDs of the subscriptions carrying tag, ignoring case.
+func (c ConfigStruct) feedIDsWithTag(tag string) map[string]bool {
+	ids := make(map[string]bool)
+	for _, s := range c.Feeds {
+		if slices.ContainsFunc(s.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			ids[s.ID] = true
+		}
+	}
+	return ids
+}
+
+// activeFeeds returns the subscriptions that should be polled.
+func (c ConfigStruct) activeFeeds() []Subscription {
+	var out []Subscription
+	for _, s := range c.Feeds {
+		if !s.Disabled && s.URL != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// feedURLs returns the URLs of every subscription that should be polled.
+func (c ConfigStruct) feedURLs() []string {
+	var out []string
+	for _, s := range c.activeFeeds() {
+		out = append(out, s.URL)
+	}
+	return out
+}
+
+// subscriptionsFromURLs builds subscriptions for a bare list of feed URLs.
+func subscriptionsFromURLs(urls []string) []Subscription {
+	subs := make([]Subscription, 0, len(urls))
+	for _, u := range urls {
+		subs = append(subs, Subscription{ID: feedID(u), URL: strings.TrimSpace(u)})
+	}
+	return subs
+}
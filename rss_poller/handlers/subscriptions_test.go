@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestConfigStructUnmarshal(t *testing.T) {
+	t.Run("LegacyURLList", func(t *testing.T) {
+		var c ConfigStruct
+		if err := json.Unmarshal([]byte(`{"rss_feeds": ["https://a.example/rss", " https://b.example/rss "]}`), &c); err != nil {
+			t.Fatal(err)
+		}
+		want := []Subscription{
+			{ID: feedID("https://a.example/rss"), URL: "https://a.example/rss"},
+			{ID: feedID("https://b.example/rss"), URL: "https://b.example/rss"},
+		}
+		if !reflect.DeepEqual(c.Feeds, want) {
+			t.Errorf("want %+v, got %+v", want, c.Feeds)
+		}
+	})
+
+	t.Run("Subscriptions", func(t *testing.T) {
+		var c ConfigStruct
+		payload := `{"feeds": [{"id": "news", "url": "https://a.example/rss", "name": "News", "tags": ["daily"], "poll_interval": "5m", "webhook_url": "https://hooks.example/1"},
+			{"url": "https://b.example/rss", "disabled": true}]}`
+		if err := json.Unmarshal([]byte(payload), &c); err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Feeds) != 2 {
+			t.Fatalf("expected 2 feeds, got %d", len(c.Feeds))
+		}
+		if c.Feeds[0].ID != "news" || c.Feeds[0].Name != "News" || time.Duration(c.Feeds[0].PollInterval) != 5*time.Minute {
+			t.Errorf("unexpected first subscription: %+v", c.Feeds[0])
+		}
+		if c.Feeds[1].ID != feedID("https://b.example/rss") {
+			t.Errorf("expected derived ID, got %q", c.Feeds[1].ID)
+		}
+		if got := c.feedURLs(); !reflect.DeepEqual(got, []string{"https://a.example/rss"}) {
+			t.Errorf("disabled feed must not be polled, got %v", got)
+		}
+	})
+
+	t.Run("MixedDoesNotDuplicate", func(t *testing.T) {
+		var c ConfigStruct
+		payload := `{"feeds": [{"url": "https://a.example/rss", "name": "A"}], "rss_feeds": ["https://a.example/rss", "https://c.example/rss"]}`
+		if err := json.Unmarshal([]byte(payload), &c); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.feedURLs(); !reflect.DeepEqual(got, []string{"https://a.example/rss", "https://c.example/rss"}) {
+			t.Errorf("unexpected feeds %v", got)
+		}
+		if c.Feeds[0].Name != "A" {
+			t.Errorf("expected subscription metadata to win over legacy entry, got %+v", c.Feeds[0])
+		}
+	})
+
+	t.Run("InvalidInterval", func(t *testing.T) {
+		var c ConfigStruct
+		if err := json.Unmarshal([]byte(`{"feeds": [{"url": "https://a.example/rss", "poll_interval": "soon"}]}`), &c); err == nil {
+			t.Error("expected an error for an invalid poll_interval")
+		}
+	})
+}
+
+func TestLoadConfigMigratesLegacyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	if err := os.WriteFile(path, []byte(`{"rss_feeds": ["http://127.0.0.1:0/rss"]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	t.Cleanup(func() {
+		setRSSFeeds(nil)
+		stopPolling()
+	})
+
+	LoadConfig(t.Context())
+
+	snapshot := getConfigSnapshot()
+	if len(snapshot.Feeds) != 1 || snapshot.Feeds[0].ID != feedID("http://127.0.0.1:0/rss") {
+		t.Fatalf("expected one migrated subscription, got %+v", snapshot.Feeds)
+	}
+
+	persistConfig(t.Context())
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var onDisk map[string]json.RawMessage
+	if err := json.Unmarshal(data, &onDisk); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := onDisk["feeds"]; !ok {
+		t.Errorf("expected persisted config to use the subscription format, got %s", data)
+	}
+}
+
+func TestLoadConfigDropsInvalidFeeds(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	body := `{"feeds": [
+		{"id": "ok", "url": "http://127.0.0.1:0/rss", "disabled": true},
+		{"id": "bad", "url": "ftp://a.example/rss"},
+		{"id": "ok", "url": "http://127.0.0.1:0/other", "disabled": true},
+		{"id": "dup", "url": "http://127.0.0.1:0/rss", "disabled": true}
+	]}`
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	resetConfig(t, ConfigStruct{})
+
+	LoadConfig(t.Context())
+	if feeds := getConfigSnapshot().Feeds; len(feeds) != 1 || feeds[0].ID != "ok" {
+		t.Fatalf("expected only the valid feed to be loaded, got %+v", feeds)
+	}
+}
+
+func TestConfigGetHandler(t *testing.T) {
+	cfgMu.Lock()
+	cfg = ConfigStruct{Feeds: []Subscription{
+		{ID: "a", URL: "https://a.example/rss", Name: "A"},
+		{ID: "b", URL: "https://b.example/rss", Disabled: true},
+	}}
+	cfgMu.Unlock()
+	t.Cleanup(func() { setRSSFeeds(nil) })
+
+	rec := httptest.NewRecorder()
+	ConfigGetHandler(rec, httptest.NewRequest(http.MethodGet, "/config/feeds", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+	var got configResponse
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Feeds) != 2 || got.Feeds[0].Name != "A" {
+		t.Errorf("unexpected subscriptions %+v", got.Feeds)
+	}
+	if !reflect.DeepEqual(got.RSSFeeds, []string{"https://a.example/rss"}) {
+		t.Errorf("expected legacy rss_feeds to list active URLs only, got %v", got.RSSFeeds)
+	}
+}
+
+func TestGroupByReceiver(t *testing.T) {
+	subs := []Subscription{
+		{URL: "https://a.example/rss"},
+		{URL: "https://b.example/rss", WebhookURL: "https://hooks.example/b"},
+		{URL: "https://c.example/rss"},
+		{URL: "https://d.example/rss"},
+	}
+	fa, fb, fc := &gofeed.Feed{Title: "a"}, &gofeed.Feed{Title: "b"}, &gofeed.Feed{Title: "c"}
+	feeds := []*gofeed.Feed{fa, fb, fc, nil}
+
+	got := groupByReceiver(subs, feeds, "https://hooks.example/default")
+	want := []receiverGroup{
+		{receiver: "https://hooks.example/default", feeds: []*gofeed.Feed{fa, fc}},
+		{receiver: "https://hooks.example/b", feeds: []*gofeed.Feed{fb}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,464 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Output formats of GET /rss. formatJSON is the feedsJSON array the frontend reads.
+const (
+	formatJSON     = "json"
+	formatAtom     = "atom"
+	formatRSS      = "rss"
+	formatJSONFeed = "jsonfeed"
+)
+
+// syndicationTitle names the aggregated feed in Atom, RSS and JSON Feed output.
+const syndicationTitle = "rss-poller"
+
+// formatMediaTypes maps the media types accepted by GET /rss to their format.
+var formatMediaTypes = map[string]string{
+	"application/json":      formatJSON,
+	"application/atom+xml":  formatAtom,
+	"application/rss+xml":   formatRSS,
+	"application/feed+json": formatJSONFeed,
+}
+
+// formatContentTypes is the Content-Type each format is served with.
+var formatContentTypes = map[string]string{
+	formatJSON:     "application/json",
+	formatAtom:     "application/atom+xml; charset=utf-8",
+	formatRSS:      "application/rss+xml; charset=utf-8",
+	formatJSONFeed: "application/feed+json",
+}
+
+// negotiateFormat picks the output format of r. The format parameter wins over
+// the Accept header; Accept falls back to the JSON array when it names none of
+// the supported types.
+func negotiateFormat(r *http.Request) (string, error) {
+	if f := r.URL.Query().Get("format"); f != "" {
+		if _, ok := formatContentTypes[f]; !ok {
+			return "", errors.New("format must be one of json, atom, rss or jsonfeed")
+		}
+		return f, nil
+	}
+	best, bestQ := formatJSON, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		f, ok := formatMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best, nil
+}
+
+// feedSource is the subscription a timeline item came from.
+type feedSource struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	// URL is the subscribed feed document, Link the site it belongs to.
+	URL  string `json:"feed_url"`
+	Link string `json:"home_page_url,omitempty"`
+}
+
+func newFeedSource(s Subscription, f *gofeed.Feed) feedSource {
+	src := feedSource{ID: s.ID, Title: s.Name, URL: s.URL, Link: f.Link}
+	if src.Title == "" {
+		src.Title = f.Title
+	}
+	if src.Title == "" {
+		src.Title = s.URL
+	}
+	return src
+}
+
+// syndicationPage is a page of the timeline and where it is served from.
+type syndicationPage struct {
+	items   []timelineItem
+	selfURL string
+	// nextURL is empty on the last page.
+	nextURL string
+}
+
+// newSyndicationPage builds the self and next links of a page from r.
+func newSyndicationPage(r *http.Request, items []timelineItem, next string) syndicationPage {
+	u := *r.URL
+	u.Host = r.Host
+	u.Scheme = "http"
+	if r.TLS != nil {
+		u.Scheme = "https"
+	}
+	if p := r.Header.Get("X-Forwarded-Proto"); p != "" {
+		u.Scheme = p
+	}
+	p := syndicationPage{items: items, selfURL: u.String()}
+	if next != "" {
+		q := u.Query()
+		q.Set("cursor", next)
+		u.RawQuery = q.Encode()
+		p.nextURL = u.String()
+	}
+	return p
+}
+
+// updated is the date of the newest item on the page, or now when none is dated.
+func (p syndicationPage) updated() time.Time {
+	var newest time.Time
+	for _, it := range p.items {
+		if d := it.updated(); d.After(newest) {
+			newest = d
+		}
+	}
+	if newest.IsZero() {
+		return time.Now().UTC()
+	}
+	return newest
+}
+
+// updated is when the item last changed: its updated date, else its published date.
+func (it timelineItem) updated() time.Time {
+	if d := it.item.UpdatedParsed; d != nil {
+		return *d
+	}
+	return it.date
+}
+
+// guid is the item's GUID, falling back to its link and then to its seen-store key.
+func (it timelineItem) guid() string {
+	switch {
+	case it.item.GUID != "":
+		return it.item.GUID
+	case it.item.Link != "":
+		return it.item.Link
+	}
+	return it.key
+}
+
+// atomID is guid when it is an absolute IRI, as Atom requires, and a tag
+// URI derived from it otherwise.
+func (it timelineItem) atomID() string {
+	id := it.guid()
+	if u, err := url.Parse(id); err == nil && u.IsAbs() {
+		return id
+	}
+	return "tag:rss-poller," + url.PathEscape(it.feedID) + ":" + url.PathEscape(id)
+}
+
+func authorNames(it *gofeed.Item) []string {
+	var names []string
+	for _, a := range it.Authors {
+		if a != nil && a.Name != "" {
+			names = append(names, a.Name)
+		}
+	}
+	return names
+}
+
+// writeSyndication writes page as an Atom, RSS 2.0 or JSON Feed document.
+func writeSyndication(ctx context.Context, w io.Writer, format string, page syndicationPage) error {
+	_, span := startSpan(ctx, "helper.writeSyndication", trace.SpanKindInternal)
+	defer span.End()
+	span.SetAttributes(attribute.String("feed.format", format), attribute.Int("items.total", len(page.items)))
+
+	var err error
+	switch format {
+	case formatAtom:
+		err = writeAtom(w, page)
+	case formatRSS:
+		err = writeRSS(w, page)
+	case formatJSONFeed:
+		err = json.NewEncoder(w).Encode(toJSONFeed(page))
+	default:
+		err = errors.New("unsupported format " + format)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	return err
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Links      []atomLink     `xml:"link"`
+	Authors    []atomPerson   `xml:"author"`
+	Categories []atomCategory `xml:"category"`
+	Summary    *atomText      `xml:"summary"`
+	Content    *atomText      `xml:"content"`
+	Source     atomSource     `xml:"source"`
+}
+
+// atomSource is Atom's reference to the feed an entry was copied from.
+type atomSource struct {
+	ID    string     `xml:"id"`
+	Title string     `xml:"title"`
+	Links []atomLink `xml:"link"`
+}
+
+func writeAtom(w io.Writer, page syndicationPage) error {
+	feedUpdated := page.updated()
+	feed := atomFeed{
+		ID:      page.selfURL,
+		Title:   syndicationTitle,
+		Updated: feedUpdated.Format(time.RFC3339),
+		Author:  atomPerson{Name: syndicationTitle},
+		Links:   []atomLink{{Rel: "self", Href: page.selfURL, Type: "application/atom+xml"}},
+	}
+	if page.nextURL != "" {
+		feed.Links = append(feed.Links, atomLink{Rel: "next", Href: page.nextURL, Type: "application/atom+xml"})
+	}
+	for _, it := range page.items {
+		// Atom requires a date on every entry; undated items take the feed's.
+		updated := it.updated()
+		if updated.IsZero() {
+			updated = feedUpdated
+		}
+		e := atomEntry{
+			ID:      it.atomID(),
+			Title:   it.item.Title,
+			Updated: updated.Format(time.RFC3339),
+			Source: atomSource{
+				ID:    it.source.URL,
+				Title: it.source.Title,
+				Links: []atomLink{{Rel: "self", Href: it.source.URL}},
+			},
+		}
+		if it.item.Link != "" {
+			e.Links = append(e.Links, atomLink{Rel: "alternate", Href: it.item.Link})
+		}
+		if it.source.Link != "" {
+			e.Source.Links = append(e.Source.Links, atomLink{Rel: "alternate", Href: it.source.Link})
+		}
+		if d := it.item.PublishedParsed; d != nil {
+			e.Published = d.Format(time.RFC3339)
+		}
+		for _, name := range authorNames(it.item) {
+			e.Authors = append(e.Authors, atomPerson{Name: name})
+		}
+		for _, c := range it.item.Categories {
+			e.Categories = append(e.Categories, atomCategory{Term: c})
+		}
+		if it.item.Description != "" {
+			e.Summary = &atomText{Type: "html", Body: it.item.Description}
+		}
+		if it.item.Content != "" {
+			e.Content = &atomText{Type: "html", Body: it.item.Content}
+		}
+		feed.Entries = append(feed.Entries, e)
+	}
+	return writeXML(w, feed)
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	AtomLinks     []rssLink `xml:"http://www.w3.org/2005/Atom link"`
+	Items         []rssItem `xml:"item"`
+}
+
+// rssLink carries the self and next links RSS 2.0 has no element for.
+type rssLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string    `xml:"title,omitempty"`
+	Link        string    `xml:"link,omitempty"`
+	Description string    `xml:"description,omitempty"`
+	Content     string    `xml:"http://purl.org/rss/1.0/modules/content/ encoded,omitempty"`
+	Author      string    `xml:"http://purl.org/dc/elements/1.1/ creator,omitempty"`
+	Categories  []string  `xml:"category"`
+	GUID        rssGUID   `xml:"guid"`
+	PubDate     string    `xml:"pubDate,omitempty"`
+	Updated     string    `xml:"http://purl.org/dc/terms/ modified,omitempty"`
+	Source      rssSource `xml:"source"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// rssSource is RSS 2.0's reference to the channel an item came from.
+type rssSource struct {
+	URL   string `xml:"url,attr"`
+	Title string `xml:",chardata"`
+}
+
+func writeRSS(w io.Writer, page syndicationPage) error {
+	doc := rssDocument{Version: "2.0", Channel: rssChannel{
+		Title:         syndicationTitle,
+		Link:          page.selfURL,
+		Description:   "Items aggregated by " + syndicationTitle,
+		LastBuildDate: page.updated().Format(time.RFC1123Z),
+		AtomLinks:     []rssLink{{Rel: "self", Href: page.selfURL, Type: "application/rss+xml"}},
+	}}
+	if page.nextURL != "" {
+		doc.Channel.AtomLinks = append(doc.Channel.AtomLinks, rssLink{Rel: "next", Href: page.nextURL, Type: "application/rss+xml"})
+	}
+	for _, it := range page.items {
+		guid := it.guid()
+		item := rssItem{
+			Title:       it.item.Title,
+			Link:        it.item.Link,
+			Description: it.item.Description,
+			Content:     it.item.Content,
+			Author:      strings.Join(authorNames(it.item), ", "),
+			Categories:  it.item.Categories,
+			GUID:        rssGUID{IsPermaLink: guid == it.item.Link, Value: guid},
+			Source:      rssSource{URL: it.source.URL, Title: it.source.Title},
+		}
+		if !it.date.IsZero() {
+			item.PubDate = it.date.Format(time.RFC1123Z)
+		}
+		if d := it.item.UpdatedParsed; d != nil {
+			item.Updated = d.Format(time.RFC3339)
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// jsonFeed is a JSON Feed 1.1 document (https://www.jsonfeed.org/version/1.1/).
+type jsonFeed struct {
+	Version string         `json:"version"`
+	Title   string         `json:"title"`
+	FeedURL string         `json:"feed_url"`
+	NextURL string         `json:"next_url,omitempty"`
+	Items   []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html,omitempty"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished *time.Time       `json:"date_published,omitempty"`
+	DateModified  *time.Time       `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	// Source is a JSON Feed extension naming the feed the item came from.
+	Source feedSource `json:"_source"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+func toJSONFeed(page syndicationPage) jsonFeed {
+	feed := jsonFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   syndicationTitle,
+		FeedURL: page.selfURL,
+		NextURL: page.nextURL,
+		Items:   make([]jsonFeedItem, 0, len(page.items)),
+	}
+	for _, it := range page.items {
+		item := jsonFeedItem{
+			ID:            it.guid(),
+			URL:           it.item.Link,
+			Title:         it.item.Title,
+			ContentHTML:   it.item.Content,
+			DatePublished: it.item.PublishedParsed,
+			DateModified:  it.item.UpdatedParsed,
+			Tags:          it.item.Categories,
+			Source:        it.source,
+		}
+		// JSON Feed items need content; the description stands in when there is none.
+		if item.ContentHTML == "" {
+			item.ContentHTML = it.item.Description
+		} else {
+			item.Summary = it.item.Description
+		}
+		if it.item.Image != nil {
+			item.Image = it.item.Image.URL
+		}
+		for _, name := range authorNames(it.item) {
+			item.Authors = append(item.Authors, jsonFeedAuthor{Name: name})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed
+}
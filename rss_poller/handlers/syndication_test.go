@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := []struct {
+		query, accept, want string
+	}{
+		{"", "", formatJSON},
+		{"", "*/*", formatJSON},
+		{"", "application/atom+xml", formatAtom},
+		{"", "text/html, application/rss+xml;q=0.9, application/atom+xml;q=0.5", formatRSS},
+		{"", "application/feed+json", formatJSONFeed},
+		{"format=atom", "application/rss+xml", formatAtom},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/rss?"+c.query, nil)
+		req.Header.Set("Accept", c.accept)
+		if got, err := negotiateFormat(req); err != nil || got != c.want {
+			t.Errorf("%q %q: got %q, %v, want %q", c.query, c.accept, got, err, c.want)
+		}
+	}
+	if _, err := negotiateFormat(httptest.NewRequest(http.MethodGet, "/rss?format=xml", nil)); err == nil {
+		t.Error("expected an unknown format to be rejected")
+	}
+}
+
+func TestRSSHandlerSyndication(t *testing.T) {
+	subs := []Subscription{
+		{ID: "news", URL: "http://news.example/feed", Name: "News"},
+		{ID: "blog", URL: "http://blog.example/feed"},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+	published := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	updated := time.Date(2026, 3, 3, 8, 0, 0, 0, time.UTC)
+	feedMutex.Lock()
+	feedCache = map[string]*gofeed.Feed{
+		"news": {Title: "Daily News", Items: []*gofeed.Item{
+			{GUID: "news-1", Title: "Headline", Link: "http://news.example/1", Description: "Summary", Content: "<p>Body</p>", PublishedParsed: &published, UpdatedParsed: &updated},
+		}},
+		"blog": {Title: "A Blog", Link: "http://blog.example/", Items: []*gofeed.Item{
+			{Title: "Undated post", Link: "http://blog.example/post"},
+		}},
+	}
+	feedMutex.Unlock()
+	t.Cleanup(func() {
+		feedMutex.Lock()
+		feedCache = make(map[string]*gofeed.Feed)
+		feedMutex.Unlock()
+	})
+
+	for _, format := range []string{formatAtom, formatRSS, formatJSONFeed} {
+		rr := httptest.NewRecorder()
+		RSSHandler(rr, httptest.NewRequest(http.MethodGet, "/rss?format="+format, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", format, rr.Code)
+		}
+		if got := rr.Header().Get("Content-Type"); got != formatContentTypes[format] {
+			t.Errorf("%s: unexpected Content-Type %q", format, got)
+		}
+		body := rr.Body.String()
+		feed, err := gofeed.NewParser().ParseString(body)
+		if err != nil {
+			t.Fatalf("%s: output does not parse: %v\n%s", format, err, body)
+		}
+		if len(feed.Items) != 2 {
+			t.Fatalf("%s: expected 2 items, got %d", format, len(feed.Items))
+		}
+		it := feed.Items[0]
+		if it.Link != "http://news.example/1" || it.Title != "Headline" {
+			t.Errorf("%s: unexpected first item %+v", format, it)
+		}
+		if !strings.Contains(it.GUID, "news-1") {
+			t.Errorf("%s: expected the original GUID to be kept, got %q", format, it.GUID)
+		}
+		if it.PublishedParsed == nil || !it.PublishedParsed.Equal(published) {
+			t.Errorf("%s: expected the original published date, got %v", format, it.PublishedParsed)
+		}
+		if format != formatRSS && (it.UpdatedParsed == nil || !it.UpdatedParsed.Equal(updated)) {
+			t.Errorf("%s: expected the original updated date, got %v", format, it.UpdatedParsed)
+		}
+		if feed.Items[1].Link != "http://blog.example/post" {
+			t.Errorf("%s: unexpected second item %+v", format, feed.Items[1])
+		}
+		for _, ref := range []string{"http://news.example/feed", "News", "http://blog.example/feed", "A Blog"} {
+			if !strings.Contains(body, ref) {
+				t.Errorf("%s: expected the source reference %q in the output", format, ref)
+			}
+		}
+	}
+
+	// A paged JSON Feed links to the next page.
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/rss?limit=1", nil)
+	req.Header.Set("Accept", "application/feed+json")
+	RSSHandler(rr, req)
+	var doc jsonFeed
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Items) != 1 || !strings.Contains(doc.NextURL, "cursor="+rr.Header().Get("X-Next-Cursor")) {
+		t.Errorf("expected one item and a next_url, got %d items and %q", len(doc.Items), doc.NextURL)
+	}
+	if doc.Items[0].Source.ID != "news" || doc.Items[0].Source.URL != "http://news.example/feed" {
+		t.Errorf("unexpected source %+v", doc.Items[0].Source)
+	}
+
+	rr = httptest.NewRecorder()
+	RSSHandler(rr, httptest.NewRequest(http.MethodGet, "/rss?format=yaml", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %d", rr.Code)
+	}
+}
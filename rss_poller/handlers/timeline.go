@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Bounds of the limit parameter of GET /rss. defaultTimelineLimit applies to
+// the syndication formats only; the JSON format returns every item unless a
+// limit is given, since the frontend does not follow X-Next-Cursor.
+const (
+	defaultTimelineLimit = 100
+	maxTimelineLimit     = 1000
+)
+
+// timelineItem is an item of the merged /rss timeline.
+type timelineItem struct {
+	feedID string
+	key    string
+	date   time.Time
+	item   *gofeed.Item
+	source feedSource
+}
+
+// timelineCursor marks the last item of a page. It is handed out base64
+// encoded and is opaque to clients.
+type timelineCursor struct {
+	FeedID string    `json:"f"`
+	Key    string    `json:"k"`
+	Date   time.Time `json:"d"`
+}
+
+func (c timelineCursor) encode() string {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeTimelineCursor(s string) (timelineCursor, error) {
+	var c timelineCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(b, &c)
+	}
+	if err != nil || c.FeedID == "" {
+		return c, errors.New("invalid cursor")
+	}
+	return c, nil
+}
+
+// timelineQuery is a parsed GET /rss request.
+type timelineQuery struct {
+	// FeedIDs restricts the timeline to these feeds; nil allows every feed.
+	FeedIDs map[string]bool
+	Since   time.Time
+	// Unread and Starred keep only items with that reader state.
+	Unread  bool
+	Starred bool
+	// Limit is the page size; 0 returns every item.
+	Limit int
+	After *timelineCursor
+}
+
+// feedParams returns the feed IDs of the repeatable feed parameter, or nil
+// when it is not set.
+func feedParams(v url.Values) map[string]bool {
+	var ids map[string]bool
+	if feeds := v["feed"]; len(feeds) > 0 {
+		ids = make(map[string]bool, len(feeds))
+		for _, id := range feeds {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// parseFeedFilter returns the feed IDs selected by the repeatable feed
+// parameter and the tag parameter, or nil when neither is set.
+func parseFeedFilter(v url.Values) map[string]bool {
+	ids := feedParams(v)
+	if tag := v.Get("tag"); tag != "" {
+		tagged := getConfigSnapshot().feedIDsWithTag(tag)
+		if ids == nil {
+			return tagged
+		}
+		for id := range ids {
+			if !tagged[id] {
+				delete(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// parseTimelineQuery parses the parameters of r, using defaultLimit when
+// there is no limit parameter.
+func parseTimelineQuery(r *http.Request, defaultLimit int) (timelineQuery, error) {
+	v := r.URL.Query()
+	q := timelineQuery{Limit: defaultLimit, FeedIDs: parseFeedFilter(v)}
+	if s := v.Get("since"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return q, errors.New("since must be an RFC 3339 date")
+		}
+		q.Since = t
+	}
+	for name, flag := range map[string]*bool{"unread": &q.Unread, "starred": &q.Starred} {
+		if s := v.Get(name); s != "" {
+			on, err := strconv.ParseBool(s)
+			if err != nil {
+				return q, errors.New(name + " must be a boolean")
+			}
+			*flag = on
+		}
+	}
+	if s := v.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxTimelineLimit {
+			return q, errors.New("limit must be between 1 and " + strconv.Itoa(maxTimelineLimit))
+		}
+		q.Limit = n
+	}
+	if s := v.Get("cursor"); s != "" {
+		c, err := decodeTimelineCursor(s)
+		if err != nil {
+			return q, err
+		}
+		q.After = &c
+	}
+	return q, nil
+}
+
+// buildTimeline merges the items of feeds, index-aligned with subs, newest
+// first. Undated items go last; ties keep the config order of their feeds
+// and the order of the items within a feed.
+func buildTimeline(subs []Subscription, feeds []*gofeed.Feed, q timelineQuery) []timelineItem {
+	var items []timelineItem
+	for i, f := range feeds {
+		if f == nil || i >= len(subs) || (q.FeedIDs != nil && !q.FeedIDs[subs[i].ID]) {
+			continue
+		}
+		source := newFeedSource(subs[i], f)
+		for _, it := range f.Items {
+			var date time.Time
+			if d := itemDate(it); d != nil {
+				date = *d
+			}
+			if !q.Since.IsZero() && date.Before(q.Since) {
+				continue
+			}
+			key := itemKey(it)
+			if q.Unread || q.Starred {
+				flags := lookupItemFlags(subs[i].ID, key)
+				if (q.Unread && flags.Read) || (q.Starred && !flags.Starred) {
+					continue
+				}
+			}
+			items = append(items, timelineItem{feedID: subs[i].ID, key: key, date: date, item: it, source: source})
+		}
+	}
+	slices.SortStableFunc(items, func(a, b timelineItem) int { return b.date.Compare(a.date) })
+	return items
+}
+
+// pageTimeline returns the page of items following q.After and the cursor of
+// the next page, which is empty on the last page.
+func pageTimeline(items []timelineItem, q timelineQuery) ([]timelineItem, string) {
+	start := 0
+	if q.After != nil {
+		start = resumeIndex(items, *q.After)
+	}
+	end := len(items)
+	if q.Limit > 0 {
+		end = min(start+q.Limit, end)
+	}
+	page := items[start:end]
+	if end == len(items) || len(page) == 0 {
+		return page, ""
+	}
+	last := page[len(page)-1]
+	return page, timelineCursor{FeedID: last.feedID, Key: last.key, Date: last.date}.encode()
+}
+
+// resumeIndex finds where the page after c starts. When the cursor's item has
+// left its feed, the page starts at the first item older than it.
+func resumeIndex(items []timelineItem, c timelineCursor) int {
+	for i, it := range items {
+		if it.feedID == c.FeedID && it.key == c.Key {
+			return i + 1
+		}
+	}
+	for i, it := range items {
+		if it.date.Before(c.Date) {
+			return i
+		}
+	}
+	return len(items)
+}
@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestRSSHandlerTimeline(t *testing.T) {
+	subs := []Subscription{
+		{ID: "news", URL: "http://news.example/feed", Tags: []string{"news"}},
+		{ID: "blog", URL: "http://blog.example/feed"},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+	day := func(d int) *time.Time {
+		t := time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC)
+		return &t
+	}
+	feedMutex.Lock()
+	feedCache = map[string]*gofeed.Feed{
+		"news": {Items: []*gofeed.Item{
+			{Link: "http://news.example/3", PublishedParsed: day(3)},
+			{Link: "http://news.example/1", PublishedParsed: day(1)},
+			{Link: "http://news.example/undated"},
+		}},
+		"blog": {Items: []*gofeed.Item{
+			{Link: "http://blog.example/4", PublishedParsed: day(4)},
+			{Link: "http://blog.example/2", UpdatedParsed: day(2)},
+		}},
+	}
+	feedMutex.Unlock()
+	t.Cleanup(func() {
+		feedMutex.Lock()
+		feedCache = make(map[string]*gofeed.Feed)
+		feedMutex.Unlock()
+	})
+
+	get := func(query string) (*httptest.ResponseRecorder, []string) {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		RSSHandler(rr, httptest.NewRequest(http.MethodGet, "/rss?"+query, nil))
+		if rr.Code != http.StatusOK {
+			return rr, nil
+		}
+		var items []feedsJSON
+		if err := json.NewDecoder(rr.Body).Decode(&items); err != nil {
+			t.Fatal(err)
+		}
+		links := []string{}
+		for _, it := range items {
+			links = append(links, it.Link)
+		}
+		return rr, links
+	}
+
+	rr, links := get("")
+	want := []string{"http://blog.example/4", "http://news.example/3", "http://blog.example/2", "http://news.example/1", "http://news.example/undated"}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("expected one timeline, newest first: want %v, got %v", want, links)
+	}
+	if rr.Header().Get("X-Total-Count") != "5" || rr.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("unexpected paging headers %v", rr.Header())
+	}
+
+	// Page through two at a time.
+	var paged []string
+	cursor := ""
+	for i := 0; i < 5; i++ {
+		rr, links := get("limit=2&cursor=" + cursor)
+		paged = append(paged, links...)
+		if cursor = rr.Header().Get("X-Next-Cursor"); cursor == "" {
+			break
+		}
+	}
+	if !reflect.DeepEqual(paged, want) {
+		t.Errorf("paging lost or repeated items: %v", paged)
+	}
+
+	if _, links := get("tag=news&since=2026-03-02T00:00:00Z"); !reflect.DeepEqual(links, []string{"http://news.example/3"}) {
+		t.Errorf("unexpected items for tag and since filters: %v", links)
+	}
+	rr, links = get("feed=blog&feed=news&limit=1")
+	if len(links) != 1 || rr.Header().Get("X-Total-Count") != "5" {
+		t.Errorf("expected a total of 5 with one item returned, got %v and %s", links, rr.Header().Get("X-Total-Count"))
+	}
+	if _, links := get("feed=unknown"); len(links) != 0 {
+		t.Errorf("expected an empty timeline for an unknown feed, got %v", links)
+	}
+	for _, bad := range []string{"limit=0", "since=yesterday", "cursor=not-a-cursor"} {
+		if rr, _ := get(bad); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", bad, rr.Code)
+		}
+	}
+}
+
+func TestRSSHandlerDefaultLimit(t *testing.T) {
+	resetConfig(t, ConfigStruct{Feeds: []Subscription{{ID: "big", URL: "http://big.example/feed"}}})
+	big := &gofeed.Feed{Title: "Big"}
+	for i := range defaultTimelineLimit + 1 {
+		big.Items = append(big.Items, &gofeed.Item{Link: fmt.Sprintf("http://big.example/%d", i)})
+	}
+	feedMutex.Lock()
+	feedCache = map[string]*gofeed.Feed{"big": big}
+	feedMutex.Unlock()
+	t.Cleanup(func() {
+		feedMutex.Lock()
+		feedCache = make(map[string]*gofeed.Feed)
+		feedMutex.Unlock()
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		RSSHandler(rr, httptest.NewRequest(http.MethodGet, "/rss?"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", query, rr.Code)
+		}
+		return rr
+	}
+
+	rr := get("")
+	var items []feedsJSON
+	if err := json.NewDecoder(rr.Body).Decode(&items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != defaultTimelineLimit+1 || rr.Header().Get("X-Next-Cursor") != "" {
+		t.Errorf("expected JSON without a limit to return every item, got %d and cursor %q", len(items), rr.Header().Get("X-Next-Cursor"))
+	}
+	if rr := get("format=rss"); rr.Header().Get("X-Next-Cursor") == "" {
+		t.Error("expected the RSS format to be paged by default")
+	}
+}
+
+func TestResumeIndexAfterItemLeftFeed(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 0, 0, 0, 0, time.UTC) }
+	items := []timelineItem{
+		{feedID: "a", key: "4", date: day(4)},
+		{feedID: "a", key: "2", date: day(2)},
+	}
+	if i := resumeIndex(items, timelineCursor{FeedID: "a", Key: "3", Date: day(3)}); i != 1 {
+		t.Errorf("expected to resume at the first older item, got %d", i)
+	}
+}
+
+func TestRSSHandlerItemSchema(t *testing.T) {
+	resetConfig(t, ConfigStruct{Feeds: []Subscription{{ID: "pod", URL: "http://pod.example/feed", Name: "The Podcast"}}})
+	published := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	updated := published.Add(time.Hour)
+	feedMutex.Lock()
+	feedCache = map[string]*gofeed.Feed{
+		"pod": {Title: "Podcast feed title", Link: "http://pod.example/", Items: []*gofeed.Item{{
+			GUID:            "episode-1",
+			Title:           "Episode 1",
+			Link:            "http://pod.example/1",
+			PublishedParsed: &published,
+			UpdatedParsed:   &updated,
+			Authors:         []*gofeed.Person{{Name: "Host", Email: "host@pod.example"}},
+			Categories:      []string{"tech"},
+			Enclosures:      []*gofeed.Enclosure{{URL: "http://pod.example/1.mp3", Type: "audio/mpeg", Length: "1234"}},
+		}}},
+	}
+	feedMutex.Unlock()
+	t.Cleanup(func() {
+		feedMutex.Lock()
+		feedCache = make(map[string]*gofeed.Feed)
+		feedMutex.Unlock()
+	})
+
+	rr := httptest.NewRecorder()
+	RSSHandler(rr, httptest.NewRequest(http.MethodGet, "/rss", nil))
+	var items []map[string]any
+	if err := json.NewDecoder(rr.Body).Decode(&items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 {
+		t.Fatalf("expected 1 item, got %d", len(items))
+	}
+	want := map[string]any{
+		"title":      "Episode 1",
+		"link":       "http://pod.example/1",
+		"guid":       "episode-1",
+		"published":  "2026-03-01T09:30:00Z",
+		"updated":    "2026-03-01T10:30:00Z",
+		"authors":    []any{map[string]any{"name": "Host", "email": "host@pod.example"}},
+		"categories": []any{"tech"},
+		"enclosures": []any{map[string]any{"url": "http://pod.example/1.mp3", "type": "audio/mpeg", "length": "1234"}},
+		"source": map[string]any{
+			"id":            "pod",
+			"title":         "The Podcast",
+			"feed_url":      "http://pod.example/feed",
+			"home_page_url": "http://pod.example/",
+		},
+	}
+	if !reflect.DeepEqual(items[0], want) {
+		t.Errorf("unexpected item schema:\nwant %v\ngot  %v", want, items[0])
+	}
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// updatesInFlight holds the seen keys of updated items whose notification
+	// is being sent, so later cycles do not notify the same edit again.
+	updatesInFlight   = make(map[string]bool)
+	updatesInFlightMu sync.Mutex
+)
+
+// reserveUpdate marks the update notification of key as in flight. It returns
+// false when one already is.
+func reserveUpdate(key string) bool {
+	updatesInFlightMu.Lock()
+	defer updatesInFlightMu.Unlock()
+	if updatesInFlight[key] {
+		return false
+	}
+	updatesInFlight[key] = true
+	return true
+}
+
+// releaseUpdates ends the reservations of the keys of fingerprints once their
+// notification was delivered and committed, or failed.
+func releaseUpdates(fingerprints map[string]string) {
+	updatesInFlightMu.Lock()
+	defer updatesInFlightMu.Unlock()
+	for k := range fingerprints {
+		delete(updatesInFlight, k)
+	}
+}
+
+// notifyUpdates reports whether NOTIFY_UPDATES asks for notifications about
+// items whose title or content changed after they were notified.
+func notifyUpdates() bool {
+	v := os.Getenv("NOTIFY_UPDATES")
+	if v == "" {
+		return false
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		log.ErrorFmt("invalid NOTIFY_UPDATES %q, update notifications disabled", v)
+	}
+	return on
+}
+
+// itemFingerprint identifies the content of an item, so edits to an item
+// that keeps its GUID or link can be told apart from new items.
+func itemFingerprint(it *gofeed.Item) string {
+	h := sha256.New()
+	for _, part := range []string{it.Title, it.Description, it.Content} {
+		h.Write([]byte(strings.TrimSpace(part)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// itemFingerprints returns the fingerprint of every keyed item in the feeds
+// of owner by seen-store key, keeping the first item when a key appears more
+// than once.
+func itemFingerprints(owner string, feeds []*gofeed.Feed) map[string]string {
+	fps := make(map[string]string)
+	for _, feed := range feeds {
+		for _, it := range feed.Items {
+			k := seenKey(owner, it)
+			if _, ok := fps[k]; k == "" || ok {
+				continue
+			}
+			fps[k] = itemFingerprint(it)
+		}
+	}
+	return fps
+}
+
+// collectUpdatedLinks compares the items of feeds that were already seen with
+// the fingerprints recorded for them. fresh are the keys collectNewLinks just
+// reserved, which are new rather than updated.
+//
+// With NOTIFY_UPDATES the links of changed items are returned together with
+// their new fingerprints, which callers record once the links were delivered.
+// The returned items are reserved until releaseUpdates, and items whose update
+// is still in flight are skipped.
+// Otherwise, and for items seen before fingerprints were kept, the new
+// fingerprint is recorded right away.
+func collectUpdatedLinks(ctx context.Context, owner string, feeds []*gofeed.Feed, fingerprints map[string]string, fresh []string) ([]string, map[string]string) {
+	_, span := startSpan(ctx, "helper.collectUpdatedLinks", trace.SpanKindInternal)
+	defer span.End()
+
+	skip := make(map[string]bool, len(fresh))
+	for _, k := range fresh {
+		skip[k] = true
+	}
+	enabled := notifyUpdates()
+	cutoff := notifyCutoff()
+	var links []string
+	updated := make(map[string]string)
+	record := make(map[string]string)
+	for _, feed := range feeds {
+		for _, it := range feed.Items {
+			k := seenKey(owner, it)
+			fp, ok := fingerprints[k]
+			if !ok || skip[k] {
+				continue
+			}
+			// Only look at the first item carrying a key, as collectNewLinks does.
+			skip[k] = true
+			old, known := seen.Fingerprint(k)
+			switch {
+			case known && old == fp:
+			case known && enabled && it.Link != "" && !tooOld(it, cutoff):
+				if reserveUpdate(k) {
+					links = append(links, it.Link)
+					updated[k] = fp
+				}
+			default:
+				record[k] = fp
+			}
+		}
+	}
+	if err := seen.SetFingerprints(record); err != nil {
+		spanErrorf(span, err, "failed to persist item fingerprints: %v", err)
+	}
+	span.SetAttributes(attribute.Int("updated.items", len(links)))
+	return links, updated
+}
+
+// onlyKeys returns the fingerprints of keys.
+func onlyKeys(fingerprints map[string]string, keys []string) map[string]string {
+	out := make(map[string]string, len(keys))
+	for _, k := range keys {
+		if fp, ok := fingerprints[k]; ok {
+			out[k] = fp
+		}
+	}
+	return out
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestCollectUpdatedLinks(t *testing.T) {
+	resetUpdates := func() {
+		updatesInFlightMu.Lock()
+		updatesInFlight = make(map[string]bool)
+		updatesInFlightMu.Unlock()
+	}
+	t.Cleanup(func() {
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+		resetUpdates()
+	})
+	original := &gofeed.Item{GUID: "post-1", Link: "http://a.example/1", Title: "Tpyo"}
+	fixed := &gofeed.Item{GUID: "post-1", Link: "http://a.example/1", Title: "Typo"}
+	brandNew := &gofeed.Item{GUID: "post-2", Link: "http://a.example/2", Title: "Second"}
+
+	setup := func() {
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+		resetUpdates()
+		feeds := []*gofeed.Feed{{Items: []*gofeed.Item{original}}}
+		_, keys := collectNewLinks(context.Background(), "", feeds)
+		commitSeen(trace.SpanFromContext(context.Background()), keys, itemFingerprints("", feeds))
+	}
+	poll := func() ([]string, map[string]string) {
+		feeds := []*gofeed.Feed{{Items: []*gofeed.Item{fixed, brandNew}}}
+		_, keys := collectNewLinks(context.Background(), "", feeds)
+		return collectUpdatedLinks(context.Background(), "", feeds, itemFingerprints("", feeds), keys)
+	}
+
+	t.Run("Enabled", func(t *testing.T) {
+		t.Setenv("NOTIFY_UPDATES", "true")
+		setup()
+		links, fps := poll()
+		if !reflect.DeepEqual(links, []string{"http://a.example/1"}) {
+			t.Fatalf("expected only the edited item, got %v", links)
+		}
+		if fps["post-1"] != itemFingerprint(fixed) {
+			t.Errorf("expected the new fingerprint to be returned, got %v", fps)
+		}
+		// Until the update was delivered the old fingerprint stays.
+		if fp, _ := seen.Fingerprint("post-1"); fp != itemFingerprint(original) {
+			t.Error("expected the fingerprint to be kept until delivery")
+		}
+		if links, _ := poll(); len(links) != 0 {
+			t.Errorf("expected an update in flight not to be sent again, got %v", links)
+		}
+		// A failed send releases the update, so the next cycle retries it.
+		releaseUpdates(fps)
+		links, fps = poll()
+		if len(links) != 1 {
+			t.Fatalf("expected a failed update to be retried, got %v", links)
+		}
+		commitSeen(trace.SpanFromContext(context.Background()), nil, fps)
+		releaseUpdates(fps)
+		if links, _ := poll(); len(links) != 0 {
+			t.Errorf("expected a delivered update not to be sent again, got %v", links)
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		setup()
+		if links, _ := poll(); len(links) != 0 {
+			t.Fatalf("expected no update notifications by default, got %v", links)
+		}
+		if fp, _ := seen.Fingerprint("post-1"); fp != itemFingerprint(fixed) {
+			t.Error("expected the new fingerprint to be recorded right away")
+		}
+	})
+
+	t.Run("UnknownFingerprint", func(t *testing.T) {
+		t.Setenv("NOTIFY_UPDATES", "true")
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+		fresh, _ := seen.Reserve([]string{"post-1"})
+		commitSeen(trace.SpanFromContext(context.Background()), fresh, nil)
+		if links, _ := poll(); len(links) != 0 {
+			t.Fatalf("expected items seen without a fingerprint not to count as updated, got %v", links)
+		}
+		if _, ok := seen.Fingerprint("post-1"); !ok {
+			t.Error("expected the fingerprint to be recorded")
+		}
+	})
+}
+
+func TestDiskSeenStoreKeepsFingerprints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "seen.log")
+	store, err := openDiskSeenStore(path, 100, maxPollInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := store.Reserve([]string{"a", "b"})
+	if err := store.Commit(keys); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetFingerprints(map[string]string{"a": "1", "b": "2", "unseen": "3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetFingerprints(map[string]string{"a": "4"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.compactLocked(); err != nil {
+		t.Fatal(err)
+	}
+	// nolint:errcheck
+	store.Close()
+
+	reopened, err := openDiskSeenStore(path, 100, maxPollInterval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if got := reopened.fingerprints(); !reflect.DeepEqual(got, map[string]string{"a": "4", "b": "2"}) {
+		t.Errorf("unexpected fingerprints after a restart: %v", got)
+	}
+	if got := reopened.orderedKeys(); !reflect.DeepEqual(got, []string{"a", "b"}) {
+		t.Errorf("unexpected keys after a restart: %v", got)
+	}
+}
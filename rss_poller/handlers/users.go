@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/FKouhai/rss-demo/libs/logger"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// User is an account of the poller. Users are read from the USERS_FILE and
+// the API_TOKENS variable and identified by their API token, sent as
+// "Authorization: Bearer <token>". Each user only sees and changes the
+// subscriptions it owns, with their items, read state and notifications.
+// Subscriptions without an owner keep being polled but are only visible while
+// no users are configured; give them an owner in the config file to hand them
+// to a user.
+type User struct {
+	Name string `json:"name"`
+	// TokenSHA256 is the hex SHA-256 of the user's API token, so the file
+	// never holds the token itself.
+	TokenSHA256 string `json:"token_sha256"`
+	// Role is "read", the default, or "admin".
+	Role string `json:"role,omitempty"`
+	// WebhookURL is where the user's feeds notify unless they set their own;
+	// it overrides NOTIFICATION_ENDPOINT.
+	WebhookURL string `json:"webhook_url,omitempty"`
+}
+
+var (
+	// users is nil while USERS_FILE is unset and every caller shares the
+	// unowned subscriptions. It is keyed by token hash.
+	users map[string]User
+	// authDisabled is set from AUTH_DISABLED and lets requests without a token
+	// change the config while no users are configured.
+	authDisabled bool
+	usersMu      sync.RWMutex
+)
+
+// Roles of a user. Readers may read everything they own and keep their read
+// state; changing subscriptions or releasing quarantined feeds takes an admin.
+const (
+	roleRead  = "read"
+	roleAdmin = "admin"
+)
+
+var (
+	// errUnauthorized is returned for requests without a known API token.
+	errUnauthorized = errors.New("missing or unknown API token")
+	// errForbidden is returned when the caller's role does not allow a request.
+	errForbidden = errors.New("the admin role is required")
+)
+
+// userKey is the context key of the authenticated user.
+type userKey struct{}
+
+// loadUsers reads the users from USERS_FILE and API_TOKENS. A list that
+// cannot be read leaves authentication on without any user, so every request
+// is refused rather than served to everyone. Without users the config can
+// only be read, unless AUTH_DISABLED opts into unauthenticated changes.
+func loadUsers() {
+	path, tokens := os.Getenv("USERS_FILE"), os.Getenv("API_TOKENS")
+	if path == "" && tokens == "" {
+		disabled := authDisabledFromEnv()
+		if disabled {
+			log.Error("SECURITY: AUTH_DISABLED is set, anyone who can reach the poller may change its config")
+		} else {
+			log.Error("no USERS_FILE or API_TOKENS set, config changes are refused; set AUTH_DISABLED=true to allow them without a token")
+		}
+		usersMu.Lock()
+		users, authDisabled = nil, disabled
+		usersMu.Unlock()
+		return
+	}
+	loaded, err := readUsers(path, tokens)
+	if err != nil {
+		log.Error("failed to load users, refusing all requests", zap.String("path", path), zap.Error(err))
+		loaded = map[string]User{}
+	}
+	log.Info("loaded users", zap.Int("users.count", len(loaded)))
+	usersMu.Lock()
+	users = loaded
+	usersMu.Unlock()
+}
+
+// readUsers reads the users of the file at path, if any, and of tokens, a
+// comma separated list of name:role:token entries, and indexes them by token
+// hash.
+func readUsers(path, tokens string) (map[string]User, error) {
+	var list []User
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, err
+		}
+	}
+	for i, entry := range strings.Split(tokens, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) != 3 || parts[2] == "" {
+			return nil, fmt.Errorf("API_TOKENS entry %d must be name:role:token", i)
+		}
+		sum := sha256.Sum256([]byte(parts[2]))
+		list = append(list, User{Name: parts[0], Role: parts[1], TokenSHA256: hex.EncodeToString(sum[:])})
+	}
+
+	loaded := make(map[string]User, len(list))
+	names := make(map[string]bool, len(list))
+	for i, u := range list {
+		hash := strings.ToLower(u.TokenSHA256)
+		switch {
+		case !feedIDPattern.MatchString(u.Name):
+			return nil, fmt.Errorf("users[%d].name must match %s", i, feedIDPattern)
+		case names[u.Name]:
+			return nil, fmt.Errorf("users[%d].name duplicates %s", i, u.Name)
+		case len(hash) != sha256.Size*2 || strings.Trim(hash, "0123456789abcdef") != "":
+			return nil, fmt.Errorf("users[%d].token_sha256 must be a hex SHA-256", i)
+		case u.Role != "" && u.Role != roleRead && u.Role != roleAdmin:
+			return nil, fmt.Errorf("users[%d].role must be %s or %s", i, roleRead, roleAdmin)
+		}
+		if _, ok := loaded[hash]; ok {
+			return nil, fmt.Errorf("users[%d].token_sha256 is shared with another user", i)
+		}
+		if u.Role == "" {
+			u.Role = roleRead
+		}
+		names[u.Name] = true
+		loaded[hash] = u
+	}
+	return loaded, nil
+}
+
+// usersEnabled reports whether callers must identify themselves.
+func usersEnabled() bool {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	return users != nil
+}
+
+// lookupUser returns the user holding token.
+func lookupUser(token string) (User, bool) {
+	sum := sha256.Sum256([]byte(token))
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	u, ok := users[hex.EncodeToString(sum[:])]
+	return u, ok
+}
+
+// userWebhook returns the notification target of the user called name.
+func userWebhook(name string) string {
+	if name == "" {
+		return ""
+	}
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	for _, u := range users {
+		if u.Name == name {
+			return u.WebhookURL
+		}
+	}
+	return ""
+}
+
+// receiver returns where notifications about s go: its own WebhookURL, then
+// its owner's webhook, then defaultReceiver.
+func (s Subscription) receiver(defaultReceiver string) string {
+	return cmp.Or(s.WebhookURL, userWebhook(s.Owner), defaultReceiver)
+}
+
+// authDisabledFromEnv reports whether AUTH_DISABLED turns authentication off.
+func authDisabledFromEnv() bool {
+	v := os.Getenv("AUTH_DISABLED")
+	if v == "" {
+		return false
+	}
+	on, err := strconv.ParseBool(v)
+	if err != nil {
+		log.ErrorFmt("invalid AUTH_DISABLED %q, authentication stays on", v)
+	}
+	return on
+}
+
+// writesOpen reports whether requests without a token may change the config.
+func writesOpen() bool {
+	usersMu.RLock()
+	defer usersMu.RUnlock()
+	return users == nil && authDisabled
+}
+
+// bearerToken returns the API token of r. EventSource cannot set headers, so
+// GET /rss/stream alone may pass it as the access_token parameter instead.
+func bearerToken(r *http.Request) string {
+	if h := r.Header.Get("Authorization"); h != "" {
+		scheme, token, ok := strings.Cut(h, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if r.Method == http.MethodGet && r.URL.Path == "/rss/stream" {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// Authenticate identifies the caller of next by its API token. Without
+// configured users every request passes through unchanged.
+func Authenticate(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !usersEnabled() {
+			next(w, r)
+			return
+		}
+		u, ok := lookupUser(bearerToken(r))
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rss-poller"`)
+			rejectRequest(w, r, http.StatusUnauthorized, errUnauthorized, "")
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), userKey{}, u)))
+	}
+}
+
+// Authorize is Authenticate for routes that change the configuration:
+// requests other than GET and HEAD need the admin role. Without configured
+// users they are refused unless AUTH_DISABLED is set.
+func Authorize(next http.HandlerFunc) http.HandlerFunc {
+	return Authenticate(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+		u, ok := r.Context().Value(userKey{}).(User)
+		switch {
+		case !ok && !writesOpen():
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rss-poller"`)
+			rejectRequest(w, r, http.StatusUnauthorized, errUnauthorized, "")
+		case ok && u.Role != roleAdmin:
+			rejectRequest(w, r, http.StatusForbidden, errForbidden, u.Name)
+		default:
+			next(w, r)
+		}
+	})
+}
+
+// rejectRequest refuses r with status and logs who was refused, with the
+// trace ID of the request.
+func rejectRequest(w http.ResponseWriter, r *http.Request, status int, err error, user string) {
+	span := trace.SpanFromContext(r.Context())
+	log.Error("request rejected",
+		zap.String("trace_id", span.SpanContext().TraceID().String()),
+		zap.String("method", r.Method),
+		zap.String("path", r.URL.Path),
+		zap.String("user", user),
+		zap.Int("status", status),
+		zap.Error(err))
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	recordHTTPSpan(span, r.Method, status)
+	w.Header().Set("Content-Type", "application/json")
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// userFrom returns the name of the authenticated caller, or "" without users.
+func userFrom(ctx context.Context) string {
+	u, _ := ctx.Value(userKey{}).(User)
+	return u.Name
+}
+
+// ownedConfig returns the part of the config the caller of ctx owns.
+func ownedConfig(ctx context.Context) ConfigStruct {
+	return getConfigSnapshot().ownedBy(userFrom(ctx))
+}
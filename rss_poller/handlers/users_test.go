@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+type testUser struct {
+	name, token, role, webhook string
+}
+
+// setUsers configures users for a test.
+func setUsers(t *testing.T, list ...testUser) {
+	t.Helper()
+	var entries []User
+	for _, u := range list {
+		sum := sha256.Sum256([]byte(u.token))
+		entries = append(entries, User{Name: u.name, TokenSHA256: hex.EncodeToString(sum[:]), Role: u.role, WebhookURL: u.webhook})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "users.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("USERS_FILE", path)
+	loadUsers()
+	t.Cleanup(func() {
+		usersMu.Lock()
+		users = nil
+		usersMu.Unlock()
+	})
+}
+
+func TestReadUsers(t *testing.T) {
+	hash := strings.Repeat("ab", sha256.Size)
+	cases := map[string]string{
+		"bad role":       `[{"name":"alice","token_sha256":"` + hash + `","role":"root"}]`,
+		"bad name":       `[{"name":"Alice!","token_sha256":"` + hash + `"}]`,
+		"duplicate name": `[{"name":"alice","token_sha256":"` + hash + `"},{"name":"alice","token_sha256":"` + strings.Repeat("cd", sha256.Size) + `"}]`,
+		"shared token":   `[{"name":"alice","token_sha256":"` + hash + `"},{"name":"bob","token_sha256":"` + hash + `"}]`,
+		"bad hash":       `[{"name":"alice","token_sha256":"secret"}]`,
+		"not json":       `alice`,
+	}
+	for name, content := range cases {
+		path := filepath.Join(t.TempDir(), "users.json")
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if loaded, err := readUsers(path, ""); err == nil || len(loaded) != 0 {
+			t.Errorf("%s: expected an error and no users, got %v, %v", name, loaded, err)
+		}
+	}
+	for _, tokens := range []string{"alice", "alice:admin:", "alice:owner:secret", "alice:read:a,alice:read:b"} {
+		if _, err := readUsers("", tokens); err == nil {
+			t.Errorf("expected API_TOKENS %q to be rejected", tokens)
+		}
+	}
+
+	loaded, err := readUsers("", "ops:admin:s3cret:with:colons, viewer::v1ew")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("s3cret:with:colons"))
+	if u := loaded[hex.EncodeToString(sum[:])]; u.Name != "ops" || u.Role != roleAdmin {
+		t.Errorf("unexpected user for the ops token %+v", u)
+	}
+	sum = sha256.Sum256([]byte("v1ew"))
+	if u := loaded[hex.EncodeToString(sum[:])]; u.Name != "viewer" || u.Role != roleRead {
+		t.Errorf("expected users to be readers by default, got %+v", u)
+	}
+
+	// An unreadable file refuses every request instead of opening up the service.
+	t.Setenv("USERS_FILE", filepath.Join(t.TempDir(), "missing.json"))
+	loadUsers()
+	t.Cleanup(func() {
+		usersMu.Lock()
+		users = nil
+		usersMu.Unlock()
+	})
+	if !usersEnabled() {
+		t.Error("expected users to stay enabled when USERS_FILE cannot be read")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	var caller string
+	handler := Authenticate(func(w http.ResponseWriter, r *http.Request) {
+		caller = userFrom(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	})
+	call := func(method, target, header string) int {
+		t.Helper()
+		caller = "-"
+		req := httptest.NewRequest(method, target, nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		req.Header.Set("Accept", "text/event-stream")
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr.Code
+	}
+
+	if code := call(http.MethodGet, "/rss", ""); code != http.StatusNoContent || caller != "" {
+		t.Errorf("expected anonymous access without users, got %d as %q", code, caller)
+	}
+
+	setUsers(t, testUser{"alice", "alice-token", roleRead, ""}, testUser{"bob", "bob-token", roleRead, ""})
+	for _, c := range []struct{ method, target, header string }{
+		{http.MethodGet, "/rss", ""},
+		{http.MethodGet, "/rss", "Bearer wrong"},
+		{http.MethodGet, "/rss", "Basic alice-token"},
+		// The token parameter is only for EventSource, which cannot set headers.
+		{http.MethodGet, "/rss?access_token=alice-token", ""},
+		{http.MethodPost, "/config?access_token=alice-token", ""},
+		{http.MethodPost, "/rss/stream?access_token=alice-token", ""},
+	} {
+		if code := call(c.method, c.target, c.header); code != http.StatusUnauthorized || caller != "-" {
+			t.Errorf("%+v: expected 401, got %d", c, code)
+		}
+	}
+	if code := call(http.MethodGet, "/rss", "Bearer bob-token"); code != http.StatusNoContent || caller != "bob" {
+		t.Errorf("expected bob to be authenticated, got %d as %q", code, caller)
+	}
+	if code := call(http.MethodGet, "/rss/stream?access_token=alice-token", ""); code != http.StatusNoContent || caller != "alice" {
+		t.Errorf("expected an event stream to authenticate by parameter, got %d as %q", code, caller)
+	}
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, "/rss", nil))
+	if rr.Header().Get("WWW-Authenticate") == "" || !strings.Contains(rr.Body.String(), errUnauthorized.Error()) {
+		t.Errorf("unexpected 401 response %v %q", rr.Header(), rr.Body.String())
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	setUsers(t, testUser{"ops", "ops-token", roleAdmin, ""}, testUser{"viewer", "viewer-token", "", ""})
+	resetConfig(t, ConfigStruct{})
+	handler := Authorize(FeedCreateHandler)
+	call := func(method, token string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := feedRequest(method, "/config/feeds", "", "", Subscription{URL: "https://a.example/rss"})
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	rr := call(http.MethodPost, "viewer-token")
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), errForbidden.Error()) {
+		t.Errorf("expected a reader to get a 403 JSON error, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr := call(http.MethodPost, "nobody"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unknown token to get 401, got %d", rr.Code)
+	}
+	if len(getConfigSnapshot().Feeds) != 0 {
+		t.Fatal("expected rejected requests to leave the config alone")
+	}
+	if rr := call(http.MethodPost, "ops-token"); rr.Code != http.StatusCreated {
+		t.Errorf("expected an admin to add a feed, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	read := Authorize(ConfigGetHandler)
+	req := httptest.NewRequest(http.MethodGet, "/config/feeds", nil)
+	req.Header.Set("Authorization", "Bearer viewer-token")
+	rr = httptest.NewRecorder()
+	read(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected a reader to read the config, got %d", rr.Code)
+	}
+}
+
+func TestAuthorizeWithoutUsers(t *testing.T) {
+	t.Setenv("USERS_FILE", "")
+	t.Setenv("API_TOKENS", "")
+	resetConfig(t, ConfigStruct{})
+	t.Cleanup(func() {
+		usersMu.Lock()
+		users, authDisabled = nil, false
+		usersMu.Unlock()
+	})
+	call := func(method string) *httptest.ResponseRecorder {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		Authorize(FeedCreateHandler)(rr, feedRequest(method, "/config/feeds", "", "", Subscription{URL: "https://a.example/rss"}))
+		return rr
+	}
+
+	loadUsers()
+	rr := call(http.MethodPost)
+	if rr.Code != http.StatusUnauthorized || !strings.Contains(rr.Body.String(), errUnauthorized.Error()) {
+		t.Errorf("expected config changes to be refused without users, got %d %q", rr.Code, rr.Body.String())
+	}
+	if len(getConfigSnapshot().Feeds) != 0 {
+		t.Fatal("expected the refused request to leave the config alone")
+	}
+	rr = httptest.NewRecorder()
+	Authorize(ConfigGetHandler)(rr, httptest.NewRequest(http.MethodGet, "/config/feeds", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected the config to stay readable without users, got %d", rr.Code)
+	}
+
+	t.Setenv("AUTH_DISABLED", "true")
+	loadUsers()
+	if rr := call(http.MethodPost); rr.Code != http.StatusCreated {
+		t.Errorf("expected AUTH_DISABLED to allow config changes, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestUserScoping(t *testing.T) {
+	setUsers(t, testUser{"alice", "alice-token", roleAdmin, ""}, testUser{"bob", "bob-token", roleAdmin, ""})
+	resetConfig(t, ConfigStruct{Feeds: []Subscription{{ID: "legacy", URL: "https://legacy.example/rss"}}})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", Authorize(ConfigHandler))
+	mux.HandleFunc("/config/feeds", Authorize(ConfigGetHandler))
+	mux.HandleFunc("POST /config/feeds", Authorize(FeedCreateHandler))
+	mux.HandleFunc("/config/feeds/{id}", Authorize(FeedHandler))
+	do := func(method, path, token string, body any) *httptest.ResponseRecorder {
+		t.Helper()
+		req := feedRequest(method, path, "", "", body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+	feedsOf := func(token string) []Subscription {
+		t.Helper()
+		var body configResponse
+		if err := json.NewDecoder(do(http.MethodGet, "/config/feeds", token, nil).Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Feeds
+	}
+
+	shared := Subscription{URL: "https://shared.example/rss"}
+	if rr := do(http.MethodPost, "/config/feeds", "alice-token", shared); rr.Code != http.StatusCreated {
+		t.Fatalf("expected alice to add a feed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := do(http.MethodPost, "/config/feeds", "bob-token", shared); rr.Code != http.StatusCreated {
+		t.Fatalf("expected bob to add the same URL, got %d: %s", rr.Code, rr.Body.String())
+	}
+	alice, bob := feedsOf("alice-token"), feedsOf("bob-token")
+	if len(alice) != 1 || alice[0].Owner != "alice" || len(bob) != 1 || bob[0].Owner != "bob" {
+		t.Fatalf("expected one feed each, got %+v and %+v", alice, bob)
+	}
+	if alice[0].ID == bob[0].ID {
+		t.Errorf("expected the same URL to get a different ID per user, got %s", alice[0].ID)
+	}
+
+	if rr := do(http.MethodGet, "/config/feeds/"+alice[0].ID, "bob-token", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected bob not to see alice's feed, got %d", rr.Code)
+	}
+	if rr := do(http.MethodDelete, "/config/feeds/"+alice[0].ID, "bob-token", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected bob not to delete alice's feed, got %d", rr.Code)
+	}
+	if rr := do(http.MethodPost, "/config/feeds", "bob-token", Subscription{ID: alice[0].ID, URL: "https://other.example/rss"}); rr.Code != http.StatusConflict {
+		t.Errorf("expected an ID taken by alice to conflict, got %d", rr.Code)
+	}
+
+	// Replacing the whole list only replaces the caller's feeds.
+	if rr := do(http.MethodPost, "/config", "bob-token", ConfigStruct{Feeds: []Subscription{{URL: "https://bob.example/rss"}}}); rr.Code != http.StatusOK {
+		t.Fatalf("expected bob to replace their feeds, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if got := feedsOf("bob-token"); len(got) != 1 || got[0].URL != "https://bob.example/rss" {
+		t.Errorf("unexpected feeds of bob %+v", got)
+	}
+	if got := feedsOf("alice-token"); len(got) != 1 || got[0].ID != alice[0].ID {
+		t.Errorf("expected alice's feeds to be untouched, got %+v", got)
+	}
+	if i := getConfigSnapshot().indexByID("legacy"); i < 0 {
+		t.Error("expected the unowned feed to be kept")
+	}
+}
+
+func TestSharedFeedPerUser(t *testing.T) {
+	setUsers(t, testUser{"alice", "alice-token", roleRead, ""}, testUser{"bob", "bob-token", roleRead, ""})
+	t.Setenv("FEED_BASELINE", "false")
+	seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+	t.Cleanup(func() {
+		seen = newMemorySeenStore(seenMaxEntries(), seenTTL())
+		feedMutex.Lock()
+		feedCache = make(map[string]*gofeed.Feed)
+		feedMutex.Unlock()
+	})
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		// nolint
+		w.Write([]byte(mockRSSFeedContent))
+	}))
+	defer server.Close()
+	subs := []Subscription{
+		{ID: "a", URL: server.URL, Owner: "alice"},
+		{ID: "b", URL: server.URL, Owner: "bob"},
+		{ID: "c", URL: server.URL, Owner: "bob", WebhookURL: "https://hooks.example/bob"},
+	}
+	resetConfig(t, ConfigStruct{Feeds: subs})
+
+	if got := withSameURL(subs[:1], subs); len(got) != 3 {
+		t.Errorf("expected every subscriber of a due URL to be polled, got %+v", got)
+	}
+
+	// Without any receiver the seen keys are committed right away.
+	pollAndNotify(subs[:2])
+	if n := hits.Load(); n != 1 {
+		t.Errorf("expected the shared URL to be fetched once, got %d", n)
+	}
+	for _, f := range cachedFeeds(subs[:2]) {
+		if f == nil || f.Title != "Test RSS Feed" {
+			t.Errorf("expected every subscription to get the shared feed, got %+v", f)
+		}
+	}
+	for _, k := range []string{"user:alice:http://example.com/item1", "user:bob:http://example.com/item1"} {
+		if !seen.Has(k) {
+			t.Errorf("expected %s to be seen", k)
+		}
+	}
+	if seen.Has("http://example.com/item1") {
+		t.Error("expected no unowned seen key for owned feeds")
+	}
+
+	setUsers(t, testUser{"alice", "alice-token", roleRead, "https://hooks.example/alice"}, testUser{"bob", "bob-token", roleRead, ""})
+	fa, fb, fc := &gofeed.Feed{Title: "a"}, &gofeed.Feed{Title: "b"}, &gofeed.Feed{Title: "c"}
+	got := groupByReceiver(subs, []*gofeed.Feed{fa, fb, fc}, "https://hooks.example/default")
+	want := []receiverGroup{
+		{owner: "alice", receiver: "https://hooks.example/alice", feeds: []*gofeed.Feed{fa}},
+		{owner: "bob", receiver: "https://hooks.example/default", feeds: []*gofeed.Feed{fb}},
+		{owner: "bob", receiver: "https://hooks.example/bob", feeds: []*gofeed.Feed{fc}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("want %+v, got %+v", want, got)
+	}
+	// Quarantine notifications resolve their receiver the same way.
+	if got := subs[0].receiver(""); got != "https://hooks.example/alice" {
+		t.Errorf("expected alice's quarantine notifications to go to their webhook, got %q", got)
+	}
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// maxConfigBytes caps the size of a JSON config payload.
+	maxConfigBytes = 256 << 10
+	// maxFeeds caps the number of subscriptions in a single config.
+	maxFeeds = 1000
+	// minPollInterval and maxPollInterval bound a per-feed poll_interval.
+	minPollInterval = 30 * time.Second
+	maxPollInterval = 7 * 24 * time.Hour
+	maxNameLength   = 200
+	maxTagLength    = 64
+)
+
+// errBodyTooLarge is returned when a request body exceeds its size cap.
+var errBodyTooLarge = errors.New("request body too large")
+
+var feedIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// fieldError is a single validation problem tied to a JSON field path.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validationError collects every problem found in a payload so clients can fix them in one go.
+type validationError struct {
+	Problems []fieldError `json:"problems"`
+}
+
+func (e *validationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Field + ": " + p.Message
+	}
+	return "invalid config: " + strings.Join(msgs, "; ")
+}
+
+func (e *validationError) add(field, format string, args ...any) {
+	e.Problems = append(e.Problems, fieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// orNil returns e as an error when it holds problems, nil otherwise.
+func (e *validationError) orNil() error {
+	if len(e.Problems) == 0 {
+		return nil
+	}
+	return e
+}
+
+// normalizeFeedURL checks that raw is an absolute http(s) URL and returns its
+// canonical form: lower-case scheme and host, no default port, no fragment.
+func normalizeFeedURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", errors.New("is required")
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", errors.New("is not a valid URL")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", errors.New("must use http or https")
+	}
+	if u.Host == "" {
+		return "", errors.New("must be an absolute URL")
+	}
+	if u.User != nil {
+		return "", errors.New("must not contain credentials")
+	}
+	host, port := strings.ToLower(u.Hostname()), u.Port()
+	if (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if port != "" {
+		u.Host += ":" + port
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	u.Fragment, u.RawFragment = "", ""
+	return u.String(), nil
+}
+
+// validateSubscription normalises s in place and records every problem under prefix.
+func validateSubscription(s *Subscription, prefix string, verr *validationError) {
+	if norm, err := normalizeFeedURL(s.URL); err != nil {
+		verr.add(prefix+"url", "%v", err)
+	} else {
+		s.URL = norm
+	}
+	if s.ID != "" && !feedIDPattern.MatchString(s.ID) {
+		verr.add(prefix+"id", "must be 1-64 characters of letters, digits, '.', '_' or '-'")
+	}
+	s.Name = strings.TrimSpace(s.Name)
+	if len(s.Name) > maxNameLength {
+		verr.add(prefix+"name", "must be at most %d characters", maxNameLength)
+	}
+	for i, tag := range s.Tags {
+		tag = strings.TrimSpace(tag)
+		s.Tags[i] = tag
+		switch {
+		case tag == "":
+			verr.add(fmt.Sprintf("%stags[%d]", prefix, i), "must not be empty")
+		case len(tag) > maxTagLength:
+			verr.add(fmt.Sprintf("%stags[%d]", prefix, i), "must be at most %d characters", maxTagLength)
+		}
+	}
+	if d := time.Duration(s.PollInterval); d != 0 && (d < minPollInterval || d > maxPollInterval) {
+		verr.add(prefix+"poll_interval", "must be between %v and %v", minPollInterval, maxPollInterval)
+	}
+	if s.WebhookURL != "" {
+		if _, err := normalizeFeedURL(s.WebhookURL); err != nil {
+			verr.add(prefix+"webhook_url", "%v", err)
+		}
+	}
+}
+
+// validateConfig normalises every subscription in c, fills in missing IDs and
+// rejects duplicate URLs or IDs. All problems are returned together.
+func validateConfig(c *ConfigStruct) error {
+	verr := &validationError{}
+	validateFeedList(c, func(i int) string { return fmt.Sprintf("feeds[%d]", i) }, verr)
+	return verr.orNil()
+}
+
+// validateFeedList is validateConfig with a caller supplied field name for each
+// subscription, so problems point at the payload position they came from.
+func validateFeedList(c *ConfigStruct, field func(i int) string, verr *validationError) {
+	if len(c.Feeds) > maxFeeds {
+		verr.add("feeds", "must contain at most %d feeds", maxFeeds)
+	}
+	urls := make(map[string]int)
+	ids := make(map[string]int)
+	for i := range c.Feeds {
+		prefix := field(i) + "."
+		validateSubscription(&c.Feeds[i], prefix, verr)
+		s := &c.Feeds[i]
+		if s.ID == "" && s.URL != "" {
+			s.ID = s.defaultID()
+		}
+		// Users may subscribe to the same URL; each of them only once.
+		key := s.Owner + " " + s.URL
+		if j, ok := urls[key]; ok && s.URL != "" {
+			verr.add(prefix+"url", "duplicates %s", field(j))
+		} else {
+			urls[key] = i
+		}
+		if j, ok := ids[s.ID]; ok && s.ID != "" {
+			verr.add(prefix+"id", "duplicates %s", field(j))
+		} else {
+			ids[s.ID] = i
+		}
+	}
+}
+
+// dropInvalidFeeds removes the subscriptions validateConfig would reject from
+// c, keeping the first of any duplicates and at most maxFeeds, and returns the
+// problems of the removed ones.
+func dropInvalidFeeds(c *ConfigStruct) []fieldError {
+	verr := &validationError{}
+	urls := make(map[string]bool)
+	ids := make(map[string]bool)
+	kept := c.Feeds[:0]
+	for i, s := range c.Feeds {
+		field := fmt.Sprintf("feeds[%d]", i)
+		before := len(verr.Problems)
+		validateSubscription(&s, field+".", verr)
+		if s.ID == "" && s.URL != "" {
+			s.ID = s.defaultID()
+		}
+		key := s.Owner + " " + s.URL
+		switch {
+		case len(verr.Problems) > before:
+		case urls[key]:
+			verr.add(field+".url", "duplicates an earlier feed")
+		case ids[s.ID]:
+			verr.add(field+".id", "duplicates an earlier feed")
+		case len(kept) >= maxFeeds:
+			verr.add(field, "is beyond the limit of %d feeds", maxFeeds)
+		default:
+			urls[key], ids[s.ID] = true, true
+			kept = append(kept, s)
+		}
+	}
+	c.Feeds = kept
+	return verr.Problems
+}
+
+// readLimited reads at most limit bytes from r and fails with errBodyTooLarge beyond that.
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
+
+// decodeStrict decodes a single JSON value into v, rejecting unknown fields and trailing data.
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON document")
+	}
+	return nil
+}
+
+// jsonFieldError turns a JSON decoding error into a field problem.
+func jsonFieldError(prefix string, err error) fieldError {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return fieldError{Field: prefix + typeErr.Field, Message: "must be a " + typeErr.Type.String()}
+	}
+	field := strings.TrimSuffix(prefix, ".")
+	if field == "" {
+		field = "body"
+	}
+	return fieldError{Field: field, Message: err.Error()}
+}
+
+// decodeConfigPayload strictly decodes a POST /config body. Both the
+// subscription format and the legacy rss_feeds list are accepted; "revision"
+// and "unread" are tolerated so clients can send back what GET /config/feeds
+// returned.
+func decodeConfigPayload(data []byte) (ConfigStruct, error) {
+	var raw struct {
+		Revision json.RawMessage   `json:"revision"`
+		Feeds    []json.RawMessage `json:"feeds"`
+		RSSFeeds []string          `json:"rss_feeds"`
+		Unread   json.RawMessage   `json:"unread"`
+	}
+	if err := decodeStrict(data, &raw); err != nil {
+		return ConfigStruct{}, &validationError{Problems: []fieldError{jsonFieldError("", err)}}
+	}
+
+	verr := &validationError{}
+	var c ConfigStruct
+	// fields remembers where each decoded subscription sits in the payload.
+	var fields []string
+	for i, item := range raw.Feeds {
+		var s Subscription
+		if err := decodeStrict(item, &s); err != nil {
+			verr.Problems = append(verr.Problems, jsonFieldError(fmt.Sprintf("feeds[%d].", i), err))
+			continue
+		}
+		c.Feeds = append(c.Feeds, s)
+		fields = append(fields, fmt.Sprintf("feeds[%d]", i))
+	}
+	// Legacy entries that mirror a subscription are expected when a client
+	// posts back what GET /config/feeds returned; only new URLs are migrated.
+	known := make(map[string]bool, len(c.Feeds))
+	for _, s := range c.Feeds {
+		if norm, err := normalizeFeedURL(s.URL); err == nil {
+			known[norm] = true
+		}
+	}
+	legacy := make(map[string]int, len(raw.RSSFeeds))
+	for i, u := range raw.RSSFeeds {
+		field := fmt.Sprintf("rss_feeds[%d]", i)
+		norm, err := normalizeFeedURL(u)
+		if err != nil {
+			verr.add(field, "%v", err)
+			continue
+		}
+		if j, ok := legacy[norm]; ok {
+			verr.add(field, "duplicates rss_feeds[%d]", j)
+			continue
+		}
+		legacy[norm] = i
+		if !known[norm] {
+			c.Feeds = append(c.Feeds, Subscription{URL: norm})
+			fields = append(fields, field)
+		}
+	}
+	validateFeedList(&c, func(i int) string { return fields[i] }, verr)
+	return c, verr.orNil()
+}
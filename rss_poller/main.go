@@ -90,8 +90,14 @@ func main() {
 
 	tracer := instrumentation.GetTracer("poller")
 
+	// Open the seen store before polling starts so a restart does not re-notify old items.
+	handlers.OpenSeenStore(context.Background())
+	// Keep items that fell off their feeds searchable across restarts.
+	handlers.OpenArchive(context.Background())
 	// Load persisted config on startup; starts polling immediately if feeds are found.
 	handlers.LoadConfig(context.Background())
+	// Apply edits to the config file (e.g. an updated ConfigMap) without a restart.
+	go handlers.WatchConfig(context.Background())
 
 	// Re-register with the locator on a heartbeat so a locator restart self-heals.
 	go startHeartbeat(tracer)
@@ -116,12 +122,27 @@ func main() {
 	}()
 
 	mux := http.NewServeMux()
-	mux.HandleFunc("/config", handlers.ConfigHandler)
-	mux.HandleFunc("/config/feeds", handlers.ConfigGetHandler)
+	mux.HandleFunc("/config", handlers.Authorize(handlers.ConfigHandler))
+	mux.HandleFunc("/config/feeds", handlers.Authorize(handlers.ConfigGetHandler))
+	mux.HandleFunc("POST /config/feeds", handlers.Authorize(handlers.FeedCreateHandler))
+	mux.HandleFunc("/config/feeds/{id}", handlers.Authorize(handlers.FeedHandler))
+	mux.HandleFunc("/config/opml", handlers.Authorize(handlers.OPMLHandler))
+	mux.HandleFunc("GET /config/revisions", handlers.Authorize(handlers.ConfigRevisionsHandler))
+	mux.HandleFunc("GET /config/revisions/diff", handlers.Authorize(handlers.ConfigRevisionDiffHandler))
+	mux.HandleFunc("GET /config/revisions/{rev}", handlers.Authorize(handlers.ConfigRevisionHandler))
+	mux.HandleFunc("POST /config/revisions/{rev}/rollback", handlers.Authorize(handlers.ConfigRollbackHandler))
+	mux.HandleFunc("GET /feeds/schedule", handlers.Authenticate(handlers.FeedScheduleHandler))
+	mux.HandleFunc("GET /feeds/status", handlers.Authenticate(handlers.FeedStatusHandler))
+	mux.HandleFunc("GET /feeds/quarantine", handlers.Authenticate(handlers.FeedQuarantineHandler))
+	mux.HandleFunc("DELETE /feeds/quarantine/{id}", handlers.Authorize(handlers.FeedReleaseHandler))
 	mux.HandleFunc("/healthz", handlers.HealthzHandler)
 	mux.HandleFunc("/ready", handlers.ReadyHandler)
-	mux.HandleFunc("/rss", handlers.RSSHandler)
+	mux.HandleFunc("/rss", handlers.Authenticate(handlers.RSSHandler))
+	mux.HandleFunc("GET /rss/search", handlers.Authenticate(handlers.RSSSearchHandler))
+	mux.HandleFunc("GET /rss/stream", handlers.Authenticate(handlers.RSSStreamHandler))
+	mux.HandleFunc("POST /items/state", handlers.Authenticate(handlers.ItemStateHandler))
+	mux.HandleFunc("POST /items/read", handlers.Authenticate(handlers.MarkReadHandler))
 	log.InfoFmt("starting server on port %d", 3000)
 	// nolint
-	http.ListenAndServe(":3000", otelhttp.NewHandler(mux, "rss_poller"))
+	http.ListenAndServe(":3000", otelhttp.NewHandler(handlers.CORS(mux), "rss_poller"))
 }